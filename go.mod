@@ -1,5 +1,9 @@
 module github.com/mipnw/kurl
 
-require github.com/stretchr/testify v1.4.0
+require (
+	github.com/stretchr/testify v1.4.0
+	golang.org/x/net v0.1.0
+	gopkg.in/yaml.v2 v2.2.2
+)
 
 go 1.13
@@ -0,0 +1,79 @@
+package kurl
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Assertions describe what every response of a run must satisfy. A response which does not is counted in
+// Result.Failures, but is still a completed request.
+type Assertions struct {
+	Status       []int             `yaml:"status"`        // accepted status codes, any when empty
+	BodyContains []string          `yaml:"body_contains"` // strings the body must contain
+	JSON         map[string]string `yaml:"json"`          // expected values at dot-separated paths into a JSON body, as for Extraction.JSON
+	MaxLatency   time.Duration     `yaml:"max_latency"`   // highest acceptable latency, none when 0
+}
+
+// ReadsBody returns whether the assertions need the response body, which requires Settings.KeepBody
+// when running their Test with DoManyTest.
+func (a *Assertions) ReadsBody() bool {
+	return len(a.BodyContains) > 0 || len(a.JSON) > 0
+}
+
+// Test returns a Test which fails a response with the first assertion it does not satisfy.
+func (a *Assertions) Test() Test {
+	paths := make([]string, 0, len(a.JSON))
+	for path := range a.JSON {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return func(resp *http.Response, latency time.Duration) error {
+		if len(a.Status) > 0 && !containsStatus(a.Status, resp.StatusCode) {
+			return fmt.Errorf("Status %d is not one of %v", resp.StatusCode, a.Status)
+		}
+		if a.MaxLatency > 0 && latency > a.MaxLatency {
+			return fmt.Errorf("Latency exceeds %v", a.MaxLatency)
+		}
+		if !a.ReadsBody() {
+			return nil
+		}
+
+		// Leave the body for other tests to read
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+
+		for _, expected := range a.BodyContains {
+			if !strings.Contains(string(body), expected) {
+				return fmt.Errorf("Body does not contain %q", expected)
+			}
+		}
+		for _, path := range paths {
+			value, ok := jsonPath(body, path)
+			if !ok {
+				return fmt.Errorf("JSON %s is missing", path)
+			}
+			if value != a.JSON[path] {
+				return fmt.Errorf("JSON %s is %q instead of %q", path, value, a.JSON[path])
+			}
+		}
+		return nil
+	}
+}
+
+func containsStatus(statuses []int, status int) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
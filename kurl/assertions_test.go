@@ -0,0 +1,170 @@
+package kurl_test
+
+import (
+	"errors"
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTestFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 4,
+	}
+	tests := make([]kurl.Test, settings.ThreadCount)
+	for i := range tests {
+		tested := 0
+		tests[i] = func(resp *http.Response, latency time.Duration) error {
+			tested++
+			if tested%2 == 0 {
+				return errors.New("Every other response fails")
+			}
+			return nil
+		}
+	}
+
+	result, err := kurl.DoManyTest(
+		settings,
+		[]*http.Request{request, request},
+		tests,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+
+	// Failed responses are still completed requests
+	assert.Equal(t, 0, result.ErrorCount)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.StatusCodesFrequency[http.StatusOK])
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount/2, result.Failures.Count)
+	assert.Equal(t, []string{"Every other response fails"}, result.Failures.Samples)
+
+	report := kurl.NewReport(settings, result, nil)
+	assert.Equal(t, result.Failures, report.Failures)
+}
+
+func TestAssertions(t *testing.T) {
+	lock := sync.Mutex{}
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		count++
+		n := count
+		lock.Unlock()
+
+		switch n % 4 {
+		case 0:
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(`{"status": "error"}`))
+		case 1:
+			rw.Write([]byte(`{"status": "ok", "data": {"id": 7}}`))
+		case 2:
+			rw.Write([]byte(`{"status": "ok", "data": {"id": 8}}`))
+		case 3:
+			rw.Write([]byte(`{"status": "ok"}`))
+		}
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	assertions := kurl.Assertions{
+		Status:       []int{http.StatusOK},
+		BodyContains: []string{`"ok"`},
+		JSON:         map[string]string{"data.id": "7"},
+	}
+	assert.True(t, assertions.ReadsBody())
+
+	settings := kurl.Settings{
+		ThreadCount:  1,
+		RequestCount: 8,
+		KeepBody:     true,
+	}
+	result, err := kurl.DoManyTest(
+		settings,
+		[]*http.Request{request},
+		[]kurl.Test{assertions.Test()},
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, settings.RequestCount, result.CompletedCount)
+	assert.Equal(t, 6, result.Failures.Count)
+	assert.ElementsMatch(t, []string{
+		"Status 500 is not one of [200]",
+		`JSON data.id is "8" instead of "7"`,
+		"JSON data.id is missing",
+	}, result.Failures.Samples)
+}
+
+func TestAssertMaxLatency(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	assertions := kurl.Assertions{MaxLatency: 5 * time.Millisecond}
+	assert.False(t, assertions.ReadsBody())
+
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 2,
+	}
+	result, err := kurl.DoManyTest(
+		settings,
+		[]*http.Request{request, request},
+		[]kurl.Test{assertions.Test(), assertions.Test()},
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.Failures.Count)
+	assert.Equal(t, []string{"Latency exceeds 5ms"}, result.Failures.Samples)
+}
+
+func TestScenarioAssertions(t *testing.T) {
+	server := newScenarioServer(t)
+	defer server.Close()
+
+	scenario, err := kurl.ParseScenario([]byte(`
+steps:
+  - name: list
+    url: ` + server.URL + `/items
+    assert:
+      status: [200]
+      body_contains: ['[]']
+  - name: missing
+    url: ` + server.URL + `/missing
+    assert:
+      status: [200, 201]
+`))
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 3,
+	}
+	result, err := kurl.DoScenario(settings, *scenario)
+	require.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.Failures.Count)
+	assert.Equal(t, 0, result.Steps[0].Failures.Count)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.Steps[1].Failures.Count)
+	assert.Equal(t, []string{"Status 404 is not one of [200 201]"}, result.Steps[1].Failures.Samples)
+}
@@ -0,0 +1,78 @@
+package kurl
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+)
+
+// SetBody sets the body of request, which kurl sends in full with every request of every thread.
+func SetBody(request *http.Request, body []byte) {
+	SetBodyFunc(
+		request,
+		func() io.ReadCloser {
+			return ioutil.NopCloser(bytes.NewReader(body))
+		},
+		int64(len(body)))
+}
+
+// SetBodyFunc sets the body of request to the readers returned by factory, which kurl calls before every request
+// of every thread. contentLength is the length of every body, or -1 if unknown.
+func SetBodyFunc(request *http.Request, factory func() io.ReadCloser, contentLength int64) {
+	request.Body = factory()
+	request.GetBody = func() (io.ReadCloser, error) {
+		return factory(), nil
+	}
+	request.ContentLength = contentLength
+	if contentLength == 0 {
+		request.Body = http.NoBody
+		request.GetBody = func() (io.ReadCloser, error) {
+			return http.NoBody, nil
+		}
+	}
+}
+
+// replayable returns copies of requests which can be sent repeatedly: a body which can only be read once is
+// buffered in memory. Requests are copied so that the caller's requests are not modified.
+func replayable(requests []*http.Request) ([]*http.Request, error) {
+	clones := make(map[*http.Request]*http.Request)
+	replayables := make([]*http.Request, len(requests))
+	for i, request := range requests {
+		if clone, ok := clones[request]; ok {
+			replayables[i] = clone
+			continue
+		}
+
+		clone := *request
+		if clone.Body != nil && clone.Body != http.NoBody && clone.GetBody == nil {
+			body, err := ioutil.ReadAll(clone.Body)
+			clone.Body.Close()
+			if err != nil {
+				return nil, errors.New("Failed to read request body: " + err.Error())
+			}
+			SetBody(&clone, body)
+		}
+		clones[request] = &clone
+		replayables[i] = &clone
+	}
+	return replayables, nil
+}
+
+// countingReader counts the bytes read from a request body, as the transport sends them.
+type countingReader struct {
+	io.ReadCloser
+	count int64
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.ReadCloser.Read(p)
+	atomic.AddInt64(&reader.count, int64(n))
+	return n, err
+}
+
+func (reader *countingReader) read() int64 {
+	return atomic.LoadInt64(&reader.count)
+}
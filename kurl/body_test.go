@@ -0,0 +1,221 @@
+package kurl_test
+
+import (
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResponseBodyIsRead(t *testing.T) {
+	body := strings.Repeat("x", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 5,
+		TracePhases:  true,
+	}
+	tests := make([]kurl.Test, settings.ThreadCount)
+	for i := range tests {
+		tests[i] = func(resp *http.Response, latency time.Duration) error {
+			// The body was discarded
+			read, err := ioutil.ReadAll(resp.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, 0, len(read))
+			return nil
+		}
+	}
+
+	result, err := kurl.DoManyTest(
+		settings,
+		[]*http.Request{request, request},
+		tests,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+	assert.Equal(t, int64(result.CompletedCount*len(body)), result.BytesReceived)
+	assert.Equal(t, int64(0), result.BytesSent)
+
+	// Connections are reused once a response was fully read
+	assert.Equal(t, settings.ThreadCount, result.Phases[kurl.PhaseConnect].Count())
+}
+
+func TestKeepBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  1,
+		RequestCount: 3,
+		KeepBody:     true,
+	}
+	tested := 0
+	tests := []kurl.Test{
+		func(resp *http.Response, latency time.Duration) error {
+			read, err := ioutil.ReadAll(resp.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, "OK", string(read))
+			tested++
+			return nil
+		},
+	}
+
+	result, err := kurl.DoManyTest(
+		settings,
+		[]*http.Request{request},
+		tests,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, settings.RequestCount, tested)
+	assert.Equal(t, int64(2*settings.RequestCount), result.BytesReceived)
+}
+
+func TestTimeToFirstByte(t *testing.T) {
+	// The server responds with headers right away, then takes a while to send the body
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+		rw.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	result, err := kurl.Do(
+		kurl.Settings{
+			ThreadCount:  2,
+			RequestCount: 2,
+			TracePhases:  true,
+		},
+		*request,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	require.Equal(t, 4, result.CompletedCount)
+
+	require.NotNil(t, result.TimeToFirstByte)
+	assert.Equal(t, result.CompletedCount, result.TimeToFirstByte.Count())
+	assert.Greater(t, int64(50*time.Millisecond), int64(result.TimeToFirstByte.Max()))
+	assert.LessOrEqual(t, int64(50*time.Millisecond), int64(result.LatencyStats().Min))
+	// The transfer starts when the client reads the first byte, a little after the server started sleeping
+	assert.LessOrEqual(t, int64(40*time.Millisecond), int64(result.Phases[kurl.PhaseTransfer].Min()))
+}
+
+// onceReader is a body which can only be read once, unlike the bodies http.NewRequest knows how to replay.
+type onceReader struct {
+	io.Reader
+}
+
+func (onceReader) Close() error {
+	return nil
+}
+
+func newBodyServer(t *testing.T, expected string, lock *sync.Mutex, seen *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "POST", req.Method)
+		body, err := ioutil.ReadAll(req.Body)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(body))
+
+		lock.Lock()
+		*seen++
+		lock.Unlock()
+		rw.Write([]byte(`OK`))
+	}))
+}
+
+func TestRequestBodyReplay(t *testing.T) {
+	body := strings.Repeat("payload", 100)
+	lock := sync.Mutex{}
+	seen := 0
+	server := newBodyServer(t, body, &lock, &seen)
+	defer server.Close()
+
+	settings := kurl.Settings{
+		ThreadCount:  5,
+		RequestCount: 5,
+	}
+	expectedCount := settings.ThreadCount * settings.RequestCount
+
+	// A body which can only be read once
+	once, err := http.NewRequest("POST", server.URL, nil)
+	require.Nil(t, err)
+	once.Body = onceReader{strings.NewReader(body)}
+
+	// A body set from bytes
+	fromBytes, err := http.NewRequest("POST", server.URL, nil)
+	require.Nil(t, err)
+	kurl.SetBody(fromBytes, []byte(body))
+
+	// A body set from a factory, with an unknown length
+	fromFunc, err := http.NewRequest("POST", server.URL, nil)
+	require.Nil(t, err)
+	kurl.SetBodyFunc(
+		fromFunc,
+		func() io.ReadCloser { return onceReader{strings.NewReader(body)} },
+		-1)
+
+	for _, request := range []*http.Request{once, fromBytes, fromFunc} {
+		seen = 0
+		result, err := kurl.Do(
+			settings,
+			*request,
+		)
+		assert.Nil(t, err)
+		require.NotNil(t, result)
+		assert.Equal(t, 0, result.ErrorCount)
+		assert.Equal(t, expectedCount, result.StatusCodesFrequency[http.StatusOK])
+		assert.Equal(t, int64(expectedCount*len(body)), result.BytesSent)
+		assert.Equal(t, expectedCount, seen)
+	}
+}
+
+func TestRequestBodyReplayMany(t *testing.T) {
+	lock := sync.Mutex{}
+	seen := 0
+	server := newBodyServer(t, "body", &lock, &seen)
+	defer server.Close()
+
+	settings := kurl.Settings{
+		ThreadCount:  3,
+		RequestCount: 4,
+		Rate:         200,
+	}
+
+	request, err := http.NewRequest("POST", server.URL, nil)
+	require.Nil(t, err)
+	request.Body = onceReader{strings.NewReader("body")}
+
+	// The same request in several threads, in the open model
+	result, err := kurl.DoMany(
+		settings,
+		[]*http.Request{request, request, request},
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.StatusCodesFrequency[http.StatusOK])
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, seen)
+}
@@ -0,0 +1,235 @@
+package kurl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// Tolerances are the changes between a baseline run and a current run which are not regressions.
+type Tolerances struct {
+	Throughput        float64 // highest relative decrease of the rate, such as 0.05 for 5%
+	ErrorRate         float64 // highest increase of the error and failure rates, in fraction of requests, such as 0.01 for 1 point
+	Latency           float64 // highest relative increase of the mean latency and percentiles, such as 0.1 for 10%
+	SignificanceLevel float64 // highest p-value of a statistically significant change, such as 0.05
+}
+
+// DefaultTolerances are the Tolerances of Compare when none are configured.
+var DefaultTolerances = Tolerances{
+	Throughput:        0.05,
+	ErrorRate:         0.01,
+	Latency:           0.1,
+	SignificanceLevel: 0.05,
+}
+
+// Comparison is the change of the statistics of a current run from a baseline run.
+type Comparison struct {
+	Metrics   []MetricComparison `json:"metrics"`
+	Regressed bool               `json:"regressed"` // a metric regressed beyond its tolerance
+}
+
+// MetricComparison is the change of one statistic between two runs. Metrics are named as for a Threshold:
+// rate, error_rate, failure_rate, mean and latency percentiles such as p99.
+//
+// The changes of the rate, of the error and failure rates, and of the mean latency are tested for statistical
+// significance, with a z-test of Poisson rates, a two-proportion z-test and Welch's t-test respectively.
+// The change of a percentile, such as p99, is tested with a two-proportion z-test of the fractions of requests
+// slower than the baseline p99 in each run: 1% of the baseline, and a fraction of the current run interpolated
+// between the min, percentiles and max it reports.
+type MetricComparison struct {
+	Metric      string  `json:"metric"`
+	Baseline    float64 `json:"baseline"`    // in the unit of the metric: milliseconds for latencies, a fraction for rates of errors
+	Current     float64 `json:"current"`     // in the unit of the metric
+	Change      float64 `json:"change"`      // relative change from the baseline, 0 when the baseline is 0
+	Tested      bool    `json:"tested"`      // the change was tested for statistical significance
+	PValue      float64 `json:"p_value"`     // probability of a change at least as large between runs of the same performance, when tested
+	Significant bool    `json:"significant"` // the change was tested and is statistically significant
+	Regression  bool    `json:"regression"`  // the change is significant and worse than its tolerance
+	Improvement bool    `json:"improvement"` // the change is significant and better than its tolerance
+}
+
+// ReadReport reads a Report serialized as JSON, such as the output of kurl -output json.
+func ReadReport(r io.Reader) (*Report, error) {
+	var report Report
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, err
+	}
+	if report.Version != ReportVersion {
+		return nil, fmt.Errorf("Unsupported report version %d, expected %d", report.Version, ReportVersion)
+	}
+	return &report, nil
+}
+
+// LoadReport reads a Report from a JSON file.
+func LoadReport(filename string) (*Report, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadReport(file)
+}
+
+// Compare compares the report of a current run to the report of a baseline run,
+// and flags the statistically significant changes beyond tolerances.
+func Compare(baseline, current *Report, tolerances Tolerances) Comparison {
+	comparison := Comparison{}
+	add := func(metric MetricComparison) {
+		if metric.Baseline != 0 {
+			metric.Change = (metric.Current - metric.Baseline) / metric.Baseline
+		}
+		metric.Significant = metric.Tested && metric.PValue <= tolerances.SignificanceLevel
+		comparison.Regressed = comparison.Regressed || metric.Regression
+		comparison.Metrics = append(comparison.Metrics, metric)
+	}
+
+	// Throughput, where lower is worse
+	rate := MetricComparison{
+		Metric:   "rate",
+		Baseline: baseline.RateHz,
+		Current:  current.RateHz,
+		Tested:   true,
+		PValue:   poissonRateTest(baseline.Completed, baseline.DurationMs/1000, current.Completed, current.DurationMs/1000),
+	}
+	if rate.PValue <= tolerances.SignificanceLevel && rate.Baseline > 0 {
+		change := (rate.Current - rate.Baseline) / rate.Baseline
+		rate.Regression = change < -tolerances.Throughput
+		rate.Improvement = change > tolerances.Throughput
+	}
+	add(rate)
+
+	// Errors and failures, where higher is worse
+	add(compareProportions("error_rate",
+		baseline.Errors, baseline.Completed+baseline.Errors,
+		current.Errors, current.Completed+current.Errors,
+		tolerances))
+	add(compareProportions("failure_rate",
+		baseline.Failures.Count, baseline.Completed,
+		current.Failures.Count, current.Completed,
+		tolerances))
+
+	// Latencies, where higher is worse
+	if baseline.Latency == nil || current.Latency == nil {
+		return comparison
+	}
+	mean := MetricComparison{
+		Metric:   "mean",
+		Baseline: baseline.Latency.MeanMs,
+		Current:  current.Latency.MeanMs,
+		Tested:   true,
+		PValue: welchTest(
+			baseline.Latency.MeanMs, baseline.Latency.StdDevMs, baseline.Latency.Count,
+			current.Latency.MeanMs, current.Latency.StdDevMs, current.Latency.Count),
+	}
+	if mean.PValue <= tolerances.SignificanceLevel {
+		mean.Regression, mean.Improvement = latencyChange(mean.Baseline, mean.Current, tolerances)
+	}
+	add(mean)
+
+	for _, name := range commonPercentiles(baseline.Latency, current.Latency) {
+		percentile := MetricComparison{
+			Metric:   name,
+			Baseline: baseline.Latency.Percentiles[name],
+			Current:  current.Latency.Percentiles[name],
+			Tested:   true,
+			PValue:   1,
+		}
+		if percentile.Current != percentile.Baseline {
+			percent, _ := metricPercent(name)
+			percentile.PValue = percentileTest(percent/100, percentile.Baseline, baseline.Latency.Count, current.Latency)
+		}
+		if percentile.PValue <= tolerances.SignificanceLevel {
+			percentile.Regression, percentile.Improvement = latencyChange(percentile.Baseline, percentile.Current, tolerances)
+		}
+		add(percentile)
+	}
+	return comparison
+}
+
+func compareProportions(metric string, x1, n1, x2, n2 int, tolerances Tolerances) MetricComparison {
+	comparison := MetricComparison{
+		Metric: metric,
+		Tested: true,
+		PValue: proportionTest(x1, n1, x2, n2),
+	}
+	if n1 > 0 {
+		comparison.Baseline = float64(x1) / float64(n1)
+	}
+	if n2 > 0 {
+		comparison.Current = float64(x2) / float64(n2)
+	}
+	if comparison.PValue <= tolerances.SignificanceLevel {
+		comparison.Regression = comparison.Current-comparison.Baseline > tolerances.ErrorRate
+		comparison.Improvement = comparison.Baseline-comparison.Current > tolerances.ErrorRate
+	}
+	return comparison
+}
+
+// percentileTest returns the two-sided p-value of the test that the fraction p of the requests of a baseline
+// run of count requests faster than value, its percentile p, is also the fraction of the current requests
+// faster than value.
+func percentileTest(p, value float64, count int, current *ReportLatency) float64 {
+	slower := func(fraction float64, n int) int {
+		return int(math.Round((1 - fraction) * float64(n)))
+	}
+	return proportionTest(slower(p, count), count, slower(latencyFraction(current, value), current.Count), current.Count)
+}
+
+// latencyFraction estimates the fraction of the latencies summarized by latency which are at most value,
+// interpolating linearly between its min, percentiles and max.
+func latencyFraction(latency *ReportLatency, value float64) float64 {
+	type point struct{ value, fraction float64 }
+	points := []point{{latency.MinMs, 0}}
+	for name, ms := range latency.Percentiles {
+		percent, _ := metricPercent(name)
+		points = append(points, point{ms, percent / 100})
+	}
+	if latency.MaxMs > 0 {
+		points = append(points, point{latency.MaxMs, 1})
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].value != points[j].value {
+			return points[i].value < points[j].value
+		}
+		return points[i].fraction < points[j].fraction
+	})
+
+	if value < points[0].value {
+		return 0
+	}
+	// The highest point at most value, then towards the next one
+	i := sort.Search(len(points), func(i int) bool { return points[i].value > value }) - 1
+	if i == len(points)-1 {
+		return points[i].fraction
+	}
+	low, high := points[i], points[i+1]
+	return low.fraction + (high.fraction-low.fraction)*(value-low.value)/(high.value-low.value)
+}
+
+// latencyChange returns whether a latency increased or decreased beyond the tolerance.
+func latencyChange(baseline, current float64, tolerances Tolerances) (regression bool, improvement bool) {
+	if baseline <= 0 {
+		return false, false
+	}
+	change := (current - baseline) / baseline
+	return change > tolerances.Latency, change < -tolerances.Latency
+}
+
+// commonPercentiles returns the names of the percentiles reported in both latencies, in increasing order.
+func commonPercentiles(baseline, current *ReportLatency) []string {
+	names := make([]string, 0, len(baseline.Percentiles))
+	for name := range baseline.Percentiles {
+		if _, ok := current.Percentiles[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		pi, _ := metricPercent(names[i])
+		pj, _ := metricPercent(names[j])
+		return pi < pj
+	})
+	return names
+}
@@ -0,0 +1,177 @@
+package kurl_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newComparedReport(completed, errors int, meanMs, p99Ms float64) *kurl.Report {
+	return &kurl.Report{
+		Version:    kurl.ReportVersion,
+		Completed:  completed,
+		Errors:     errors,
+		DurationMs: 10000,
+		RateHz:     float64(completed) / 10,
+		Latency: &kurl.ReportLatency{
+			Count:       completed,
+			MeanMs:      meanMs,
+			StdDevMs:    10,
+			Percentiles: map[string]float64{"p50": meanMs, "p99": p99Ms, "p99.9": p99Ms},
+		},
+	}
+}
+
+func findMetric(t *testing.T, comparison kurl.Comparison, metric string) kurl.MetricComparison {
+	for _, m := range comparison.Metrics {
+		if m.Metric == metric {
+			return m
+		}
+	}
+	require.Fail(t, "missing metric "+metric)
+	return kurl.MetricComparison{}
+}
+
+func TestCompareSameRun(t *testing.T) {
+	report := newComparedReport(1000, 5, 100, 150)
+	comparison := kurl.Compare(report, report, kurl.DefaultTolerances)
+	assert.False(t, comparison.Regressed)
+
+	names := make([]string, len(comparison.Metrics))
+	for i, metric := range comparison.Metrics {
+		names[i] = metric.Metric
+		assert.Zero(t, metric.Change, metric.Metric)
+		assert.False(t, metric.Regression, metric.Metric)
+		assert.False(t, metric.Improvement, metric.Metric)
+		if metric.Tested {
+			assert.InDelta(t, 1, metric.PValue, 1e-9, metric.Metric)
+			assert.False(t, metric.Significant, metric.Metric)
+		}
+	}
+	assert.Equal(t, []string{"rate", "error_rate", "failure_rate", "mean", "p50", "p99", "p99.9"}, names)
+}
+
+func TestCompareRegression(t *testing.T) {
+	baseline := newComparedReport(1000, 5, 100, 150)
+	current := newComparedReport(800, 40, 130, 200)
+	comparison := kurl.Compare(baseline, current, kurl.DefaultTolerances)
+	assert.True(t, comparison.Regressed)
+
+	rate := findMetric(t, comparison, "rate")
+	assert.InDelta(t, -0.2, rate.Change, 1e-9)
+	assert.True(t, rate.Significant)
+	assert.True(t, rate.Regression)
+
+	errorRate := findMetric(t, comparison, "error_rate")
+	assert.InDelta(t, 5.0/1005, errorRate.Baseline, 1e-9)
+	assert.InDelta(t, 40.0/840, errorRate.Current, 1e-9)
+	assert.True(t, errorRate.Regression)
+
+	mean := findMetric(t, comparison, "mean")
+	assert.True(t, mean.Tested)
+	assert.Less(t, mean.PValue, 1e-6)
+	assert.True(t, mean.Regression)
+
+	p99 := findMetric(t, comparison, "p99")
+	assert.True(t, p99.Tested)
+	assert.Less(t, p99.PValue, 1e-6)
+	assert.True(t, p99.Significant)
+	assert.True(t, p99.Regression)
+
+	// The same changes are within loose tolerances
+	comparison = kurl.Compare(baseline, current, kurl.Tolerances{
+		Throughput:        0.5,
+		ErrorRate:         0.1,
+		Latency:           0.5,
+		SignificanceLevel: 0.05,
+	})
+	assert.False(t, comparison.Regressed)
+
+	// And the other way round they are improvements
+	comparison = kurl.Compare(current, baseline, kurl.DefaultTolerances)
+	assert.False(t, comparison.Regressed)
+	assert.True(t, findMetric(t, comparison, "rate").Improvement)
+	assert.True(t, findMetric(t, comparison, "error_rate").Improvement)
+	assert.True(t, findMetric(t, comparison, "mean").Improvement)
+}
+
+func TestCompareInsignificantChange(t *testing.T) {
+	// A 20% slower mean on a handful of noisy requests is not significant
+	baseline := newComparedReport(5, 0, 100, 150)
+	current := newComparedReport(5, 0, 120, 150)
+	baseline.Latency.StdDevMs = 50
+	current.Latency.StdDevMs = 50
+	current.Latency.Percentiles = baseline.Latency.Percentiles
+
+	comparison := kurl.Compare(baseline, current, kurl.DefaultTolerances)
+	mean := findMetric(t, comparison, "mean")
+	assert.InDelta(t, 0.2, mean.Change, 1e-9)
+	assert.Greater(t, mean.PValue, 0.05)
+	assert.False(t, mean.Significant)
+	assert.False(t, mean.Regression)
+	assert.False(t, comparison.Regressed)
+}
+
+func TestCompareNoisyPercentile(t *testing.T) {
+	// A p99 a third slower on a handful of requests is not significant, and does not fail the comparison
+	baseline := newComparedReport(5, 0, 100, 150)
+	current := newComparedReport(5, 0, 100, 200)
+
+	comparison := kurl.Compare(baseline, current, kurl.DefaultTolerances)
+	p99 := findMetric(t, comparison, "p99")
+	assert.InDelta(t, 1.0/3, p99.Change, 1e-9)
+	assert.True(t, p99.Tested)
+	assert.Greater(t, p99.PValue, 0.05)
+	assert.False(t, p99.Significant)
+	assert.False(t, p99.Regression)
+	assert.False(t, comparison.Regressed)
+
+	// The same change over many requests is significant
+	baseline = newComparedReport(10000, 0, 100, 150)
+	current = newComparedReport(10000, 0, 100, 200)
+	current.Latency.MaxMs = 300
+	comparison = kurl.Compare(baseline, current, kurl.DefaultTolerances)
+	p99 = findMetric(t, comparison, "p99")
+	assert.True(t, p99.Significant)
+	assert.True(t, p99.Regression)
+	assert.True(t, comparison.Regressed)
+}
+
+func TestCompareWithoutLatencies(t *testing.T) {
+	baseline := newComparedReport(1000, 0, 100, 150)
+	current := &kurl.Report{Version: kurl.ReportVersion, Errors: 1000, DurationMs: 10000}
+
+	comparison := kurl.Compare(baseline, current, kurl.DefaultTolerances)
+	assert.True(t, comparison.Regressed)
+	assert.Len(t, comparison.Metrics, 3)
+	assert.True(t, findMetric(t, comparison, "error_rate").Regression)
+}
+
+func TestReadReport(t *testing.T) {
+	settings := kurl.Settings{ThreadCount: 2, RequestCount: 2}
+	result := &kurl.Result{
+		CompletedCount:       2,
+		StatusCodesFrequency: map[int]int{200: 2},
+		OverallDuration:      time.Second,
+		Latencies:            []time.Duration{10 * time.Millisecond, 20 * time.Millisecond},
+	}
+	report := kurl.NewReport(settings, result, []float64{50, 99})
+
+	var buffer bytes.Buffer
+	require.Nil(t, json.NewEncoder(&buffer).Encode(report))
+	read, err := kurl.ReadReport(&buffer)
+	require.Nil(t, err)
+	assert.Equal(t, report.Completed, read.Completed)
+	assert.Equal(t, report.Latency, read.Latency)
+	assert.False(t, kurl.Compare(&report, read, kurl.DefaultTolerances).Regressed)
+
+	_, err = kurl.ReadReport(strings.NewReader(`{"version": 999}`))
+	assert.NotNil(t, err)
+	_, err = kurl.ReadReport(strings.NewReader(`completed: 2`))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,136 @@
+package kurl_test
+
+import (
+	"context"
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDoContextCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("block") != "" {
+			// Only returns when kurl aborts the request
+			<-req.Context().Done()
+			return
+		}
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+	blocking, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+	blocking.Header.Add("block", "true")
+
+	settings := kurl.Settings{
+		ThreadCount: 2,
+		Duration:    time.Hour,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	result, err := kurl.DoManyContext(
+		ctx,
+		settings,
+		[]*http.Request{request, blocking},
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.True(t, result.Interrupted)
+	assert.Less(t, int64(result.OverallDuration), int64(time.Second))
+	assert.Equal(t, 0, result.ErrorCount)
+	assert.Less(t, 0, result.CompletedCount)
+	assert.Equal(t, result.CompletedCount, result.StatusCodesFrequency[http.StatusOK])
+}
+
+func TestDoContextCancelRate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount: 5,
+		Duration:    time.Hour,
+		Rate:        100,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	result, err := kurl.DoContext(
+		ctx,
+		settings,
+		*request,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.True(t, result.Interrupted)
+	assert.Less(t, int64(result.OverallDuration), int64(time.Second))
+	assert.Equal(t, 0, result.ErrorCount)
+	assert.Less(t, 0, result.CompletedCount)
+}
+
+func TestDoContextCancelWarm(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 2,
+		WarmDuration: time.Hour,
+		Interval:     time.Second,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// An interruption during the warm-up is not a failure, but leaves nothing measured
+	result, err := kurl.DoContext(ctx, settings, *request)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.True(t, result.Interrupted)
+	assert.Equal(t, 0, result.CompletedCount)
+	assert.Equal(t, 0, result.ErrorCount)
+	assert.Empty(t, result.Intervals)
+}
+
+func TestDoContextNotInterrupted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 2,
+	}
+
+	result, err := kurl.DoContext(
+		context.Background(),
+		settings,
+		*request,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.False(t, result.Interrupted)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+}
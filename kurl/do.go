@@ -3,23 +3,59 @@
 package kurl
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"net/http"
 	"sync"
 	"time"
 )
 
-// Test is a function to run on the response of every http request
-type Test func(response *http.Response, latency time.Duration)
+// Test is a function to run on the response of every http request which completed.
+// Returning an error marks the response as failed in Result.Failures.
+// A Test is not called for requests which received no response: those are counted in Result.ErrorCount
+// and Result.Errors.
+type Test func(response *http.Response, latency time.Duration) error
 
 // Settings parameterizes the behavior the kurl.Do function.
+// When Rate is non-zero, ThreadCount caps the number of concurrent requests, and the run lasts
+// for Duration, or for RequestCount*ThreadCount requests when Duration is zero.
 type Settings struct {
-	Timeout             time.Duration // http client timeout
-	Verbose             bool          // increase kurl's verbosity
-	WaitBetweenRequests time.Duration // delay between requests on each thread
-	ThreadCount         int           // number of threads
-	RequestCount        int           // number of identical and consecutive requests per thread
-	Warm                bool          // warm up with 1 http request request
+	Timeout             time.Duration  // http client timeout
+	Verbose             bool           // increase kurl's verbosity
+	WaitBetweenRequests time.Duration  // delay between requests on each thread
+	ThreadCount         int            // number of threads
+	RequestCount        int            // number of identical and consecutive requests per thread
+	Duration            time.Duration  // how long each thread keeps issuing requests, overrides RequestCount when non-zero
+	Rate                float64        // requests per second sent on a fixed timeline, regardless of response times (open model)
+	Warm                bool           // warm up with 1 http request per thread, unless WarmCount or WarmDuration is set
+	WarmCount           int            // number of unmeasured requests each thread sends before the run
+	WarmDuration        time.Duration  // how long each thread sends unmeasured requests before the run, overrides WarmCount when non-zero
+	HistogramPrecision  int            // significant digits (1-5) of a latency histogram replacing Result.Latencies, 0 to store every latency
+	HistogramMax        time.Duration  // highest latency tracked by the histogram, DefaultHistogramMax when 0
+	Progress            func(Progress) // called periodically during the run with a snapshot of the statistics so far
+	ProgressInterval    time.Duration  // how often Progress is called, DefaultProgressInterval when 0
+	Interval            time.Duration  // width of the intervals of Result.Intervals, no time series is recorded when 0
+	TracePhases         bool           // time the phases of every request, reported in Result.Phases
+	KeepBody            bool           // keep response bodies in memory for Test to read, instead of discarding them
+	DisableKeepAlives   bool           // open a new connection for every request
+	MaxConnsPerHost     int            // cap on the connections of each transport to a host, unlimited when 0
+	MaxIdleConnsPerHost int            // idle connections each transport keeps per host, one per thread using it when 0
+	IdleConnTimeout     time.Duration  // how long an idle connection is kept open, 90s when 0
+	Protocol            Protocol       // HTTP version of the requests, negotiated when ProtocolAuto
+	SharedTransport     bool           // all threads share one transport and its connections, instead of one transport per thread
+	TLSConfig           *tls.Config    // TLS configuration of the transports, such as trusted CAs and client certificates, see LoadTLSConfig
+
+	// Stages, when set, is a load profile ramping the number of active threads up and down, instead of releasing
+	// ThreadCount threads at once. It overrides Duration and RequestCount, and its targets cannot exceed ThreadCount.
+	Stages []Stage
+
+	// Transport, when set, is called once per thread with the transport kurl configured from the settings above,
+	// shared by all threads with SharedTransport, and returns the RoundTripper the thread sends its requests with:
+	// base wrapped in an authentication or tracing middleware, or an in-memory RoundTripper for unit tests.
+	// Kurl wraps the returned RoundTripper to measure its responses. Connection reuse and TLS statistics are
+	// only reported for requests sent through an http.Transport.
+	Transport func(base http.RoundTripper) http.RoundTripper
 }
 
 // Result is the type of the return value of the Do function.
@@ -27,21 +63,50 @@ type Settings struct {
 type Result struct {
 	CompletedCount       int
 	ErrorCount           int
+	Errors               map[ErrorCategory]ErrorSummary // breakdown of ErrorCount by category
+	Failures             ErrorSummary                   // completed requests whose response failed its Test
 	OverallDuration      time.Duration
-	Latencies            []time.Duration
+	Latencies            []time.Duration // time to the last byte, 0 for requests which errored, nil when Histogram is used
+	Histogram            *Histogram      // latencies of completed requests, when Settings.HistogramPrecision is not 0
 	StatusCodesFrequency map[int]int
+	Interrupted          bool                 // the context was done before the run completed, the statistics only cover part of the run
+	Intervals            []Interval           // statistics of consecutive intervals of the run, when Settings.Interval is not 0
+	Phases               map[Phase]*Histogram // durations of the phases of completed requests, when Settings.TracePhases is set
+	TimeToFirstByte      *Histogram           // time to the first byte of completed requests
+	BytesReceived        int64                // response body bytes of completed requests
+	BytesSent            int64                // request body bytes of completed requests
+	Steps                []StepResult         // statistics of each step, when running a Scenario
+	Protocols            map[string]int       // completed requests by protocol of the response, such as HTTP/1.1 or HTTP/2.0
+	ConnectionsReused    int                  // completed requests sent on a connection reused from a previous request
+	TLSVersions          map[string]int       // completed requests over TLS by version, such as TLS 1.3
+	CipherSuites         map[string]int       // completed requests over TLS by cipher suite, such as TLS_AES_128_GCM_SHA256
+	TLSHandshakes        *Histogram           // durations of the TLS handshakes of the completed requests which opened a connection
+	Stages               []StageResult        // statistics of each stage of the load profile, when Settings.Stages is set
+
+	sortedLatencies []time.Duration // successful latencies in ascending order, computed on demand
 }
 
 // Do issues a set of concurrent and identical HTTP requests.
 func Do(
 	settings Settings,
 	request http.Request,
+) (*Result, error) {
+	return DoContext(context.Background(), settings, request)
+}
+
+// DoContext is like Do, but stops all threads and aborts in-flight requests when ctx is done.
+// The statistics observed until then are returned in a Result flagged as Interrupted, with none when ctx is done
+// during the warm-up.
+func DoContext(
+	ctx context.Context,
+	settings Settings,
+	request http.Request,
 ) (*Result, error) {
 	requests := make([]*http.Request, settings.ThreadCount)
 	for i := 0; i < settings.ThreadCount; i++ {
 		requests[i] = &request
 	}
-	return DoMany(settings, requests)
+	return DoManyContext(ctx, settings, requests)
 }
 
 func aggregateResults(
@@ -52,14 +117,50 @@ func aggregateResults(
 	result := Result{
 		OverallDuration:      elapsed,
 		StatusCodesFrequency: make(map[int]int),
+		Errors:               make(map[ErrorCategory]ErrorSummary),
+		Protocols:            make(map[string]int),
+		TLSVersions:          make(map[string]int),
+		CipherSuites:         make(map[string]int),
+	}
+	result.TimeToFirstByte, _ = newHistogram(&settings)
+	result.TLSHandshakes, _ = newHistogram(&settings)
+	if settings.HistogramPrecision != 0 {
+		result.Histogram, _ = newHistogram(&settings)
+	}
+	if settings.TracePhases {
+		result.Phases = newPhaseHistograms(&settings)
 	}
 
-	for i := 0; i < settings.ThreadCount; i++ {
+	for i := range workerResults {
 		result.ErrorCount += workerResults[i].errorCount
-		result.CompletedCount += len(workerResults[i].latency) - workerResults[i].errorCount
+		mergeErrors(result.Errors, workerResults[i].errors)
+		mergeSummary(&result.Failures, workerResults[i].failures)
+		result.CompletedCount += workerResults[i].completedCount
+		if result.Histogram != nil {
+			result.Histogram.Merge(workerResults[i].histogram)
+		} else {
+			result.Latencies = append(result.Latencies, workerResults[i].latency...)
+		}
 		for statusCode, freq := range workerResults[i].statusCodesCount {
 			result.StatusCodesFrequency[statusCode] += freq
 		}
+		result.TimeToFirstByte.Merge(workerResults[i].firstByte)
+		result.BytesReceived += workerResults[i].bytesReceived
+		result.BytesSent += workerResults[i].bytesSent
+		result.ConnectionsReused += workerResults[i].reused
+		for protocol, count := range workerResults[i].protocols {
+			result.Protocols[protocol] += count
+		}
+		for version, count := range workerResults[i].tlsVersions {
+			result.TLSVersions[version] += count
+		}
+		for suite, count := range workerResults[i].cipherSuites {
+			result.CipherSuites[suite] += count
+		}
+		result.TLSHandshakes.Merge(workerResults[i].handshakes)
+		for phase, histogram := range workerResults[i].phases {
+			result.Phases[phase].Merge(histogram)
+		}
 	}
 
 	return result
@@ -70,17 +171,38 @@ func aggregateResults(
 func DoMany(
 	settings Settings,
 	requests []*http.Request, // length of this array must be equal to settings.ThreadCount
+) (*Result, error) {
+	return DoManyContext(context.Background(), settings, requests)
+}
+
+// DoManyContext is like DoMany, but stops all threads and aborts in-flight requests when ctx is done.
+func DoManyContext(
+	ctx context.Context,
+	settings Settings,
+	requests []*http.Request, // length of this array must be equal to settings.ThreadCount
 ) (*Result, error) {
 	tests := make([]Test, settings.ThreadCount)
-	return DoManyTest(settings, requests, tests)
+	return DoManyTestContext(ctx, settings, requests, tests)
 }
 
 // DoManyTest issues a set of concurrent HTTP requests, where each thread issues a sequence of requests that
-// can be different from other threads, and tests each HTTP response.
+// can be different from other threads, and tests each HTTP response of a completed request.
+// Every request sends the full request body: a body set without GetBody, such as an *os.File,
+// is read once and kept in memory. See SetBody and SetBodyFunc.
 func DoManyTest(
 	settings Settings,
 	requests []*http.Request, // length of this array must be equal to settings.ThreadCount
 	tests []Test, // length of this array must be equal to settings.ThreadCount
+) (*Result, error) {
+	return DoManyTestContext(context.Background(), settings, requests, tests)
+}
+
+// DoManyTestContext is like DoManyTest, but stops all threads and aborts in-flight requests when ctx is done.
+func DoManyTestContext(
+	ctx context.Context,
+	settings Settings,
+	requests []*http.Request, // length of this array must be equal to settings.ThreadCount
+	tests []Test, // length of this array must be equal to settings.ThreadCount
 ) (*Result, error) {
 	if settings.ThreadCount != len(requests) {
 		return nil, errors.New("The length of requests must be equal to settings.ThreadCount")
@@ -88,6 +210,121 @@ func DoManyTest(
 	if settings.ThreadCount != len(tests) {
 		return nil, errors.New("The length of tests must be equal to settings.ThreadCount")
 	}
+	for i := 0; i < settings.ThreadCount; i++ {
+		if requests[i] == nil {
+			return nil, errors.New("The requests array cannot contain nil pointers")
+		}
+	}
+	if err := validateSettings(&settings); err != nil {
+		return nil, err
+	}
+	for _, request := range requests {
+		if err := validateScheme(&settings, request.URL.String()); err != nil {
+			return nil, err
+		}
+	}
+
+	// Every request of every thread must send the full body
+	requests, err := replayable(requests)
+	if err != nil {
+		return nil, err
+	}
+
+	// Prepare one sender per thread, each with its own client and its own copy of the request
+	timeSeries := newTimeSeries(&settings)
+	stages := newStageSeries(&settings)
+	workerResults := make([]workerResult, settings.ThreadCount)
+	flows := make([]*flow, settings.ThreadCount)
+	clients, err := newClients(&settings, settings.ThreadCount)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < settings.ThreadCount; i++ {
+		workerResults[i].init(&settings, timeSeries, stages)
+		flows[i] = &flow{
+			senders: []*sender{newSender(ctx, &settings, clients[i], requests[i], tests[i], &workerResults[i])},
+		}
+	}
+
+	return run(ctx, settings, flows, workerResults, timeSeries, stages)
+}
+
+// validateSettings returns an error if settings do not describe a valid run.
+func validateSettings(settings *Settings) error {
+	if settings.Rate < 0 {
+		return errors.New("settings.Rate cannot be negative")
+	}
+	if settings.Rate > 0 && settings.ThreadCount < 1 {
+		return errors.New("settings.ThreadCount must be at least 1 with settings.Rate")
+	}
+	if settings.WarmCount < 0 {
+		return errors.New("settings.WarmCount cannot be negative")
+	}
+	if settings.WarmDuration < 0 {
+		return errors.New("settings.WarmDuration cannot be negative")
+	}
+	if settings.HistogramPrecision != 0 {
+		if _, err := newHistogram(settings); err != nil {
+			return err
+		}
+	}
+	if err := validateStages(settings); err != nil {
+		return err
+	}
+	return validateTransport(settings)
+}
+
+// run warms up, then runs one flow per thread and aggregates the results of all workers.
+func run(
+	ctx context.Context,
+	settings Settings,
+	flows []*flow,
+	workerResults []workerResult,
+	timeSeries *timeSeries,
+	stages *stageSeries,
+) (*Result, error) {
+	defer closeIdleConnections(flows)
+
+	// Warm
+	if settings.warms() {
+		if err := warmAll(ctx, &settings, flows); err != nil {
+			return nil, err
+		}
+
+		// The measured run takes the rows of its feeder from the first ones
+		for _, f := range flows {
+			if f.feed != nil {
+				f.feed.rewind()
+			}
+		}
+
+		// Interrupted during the warm-up, nothing was measured
+		if ctx.Err() != nil {
+			result := aggregateResults(settings, 0, workerResults)
+			result.Interrupted = true
+			result.Intervals = timeSeries.result(0)
+			result.Stages = stages.result()
+			return &result, nil
+		}
+	}
+
+	if settings.Rate > 0 {
+		return doOpenModel(ctx, settings, flows, workerResults, timeSeries)
+	}
+	return doClosedModel(ctx, settings, flows, workerResults, timeSeries, stages)
+}
+
+// doClosedModel releases all threads at once, or as the load profile of settings.Stages ramps up,
+// each sending its next request as soon as the previous one completed.
+func doClosedModel(
+	ctx context.Context,
+	settings Settings,
+	flows []*flow,
+	workerResults []workerResult,
+	timeSeries *timeSeries,
+	stages *stageSeries,
+) (*Result, error) {
+	profile := newLoadProfile(&settings)
 
 	// Prepare thread synchronization
 	var workersReady sync.WaitGroup
@@ -96,51 +333,59 @@ func DoManyTest(
 	workersBegin.Add(1)
 
 	// Launch one worker per thread, all blocked on workersBegin signal
-	workerResults := make([]workerResult, settings.ThreadCount)
-	latencies := make([]time.Duration, settings.RequestCount*settings.ThreadCount)
 	for i := 0; i < settings.ThreadCount; i++ {
-		workerResults[i].latency = latencies[i*settings.RequestCount : ((i + 1) * settings.RequestCount)]
-		workerResults[i].statusCodesCount = make(map[int]int)
-
 		workersReady.Add(1)
 		workersComplete.Add(1)
 
-		if requests[i] == nil {
-			return nil, errors.New("The requests array cannot contain nil pointers")
-		}
-
 		go worker(
+			ctx,
 			&settings,
-			*requests[i], // a copy of the request on the stack, each worker can independently modify the request inside http.Do
-			tests[i],
+			flows[i],
+			profile,
+			i,
 			&workersBegin,
 			&workersReady,
 			&workersComplete,
-			&workerResults[i],
 		)
 	}
 
-	// Warm
-	if settings.Warm {
-		_, err := http.Get(requests[0].URL.String())
-		if err != nil {
-			return nil, errors.New("Warm failed: " + err.Error())
-		}
-	}
-
 	// Wait until all workers are ready
 	workersReady.Wait()
 
 	// Release all the workers
 	start := time.Now()
+	if timeSeries != nil {
+		timeSeries.start = start
+	}
+	if profile != nil {
+		profile.start = start
+		stages.start = start
+	}
 	workersBegin.Done()
+	stopProgress := startProgress(&settings, start, workerResults)
 
 	// Wait until all workers are done
 	workersComplete.Wait()
 	elapsed := time.Since(start)
+	stopProgress()
 
 	// Aggregate statistics
 	result := aggregateResults(settings, elapsed, workerResults)
-	result.Latencies = latencies
+	result.Interrupted = ctx.Err() != nil
+	result.Intervals = timeSeries.result(elapsed)
+	result.Stages = stages.result()
 	return &result, nil
 }
+
+// newHistogram creates an empty latency histogram as configured by settings.
+func newHistogram(settings *Settings) (*Histogram, error) {
+	precision := settings.HistogramPrecision
+	if precision == 0 {
+		precision = defaultHistogramPrecision
+	}
+	max := settings.HistogramMax
+	if max == 0 {
+		max = DefaultHistogramMax
+	}
+	return NewHistogram(precision, max)
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/mipnw/kurl/kurl"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
@@ -239,8 +240,9 @@ func TestDoManyTest(t *testing.T) {
 		require.Nil(t, err)
 		requests[i].Header.Add("test", strconv.Itoa(i))
 
-		tests[i] = kurl.Test(func(resp *http.Response, latency time.Duration) {
+		tests[i] = kurl.Test(func(resp *http.Response, latency time.Duration) error {
 			require.Equal(t, 200, resp.StatusCode)
+			return nil
 		})
 	}
 
@@ -261,6 +263,47 @@ func TestDoManyTest(t *testing.T) {
 	assert.Equal(t, result.CompletedCount, result.StatusCodesFrequency[http.StatusOK])
 }
 
+func TestDoManyTestErrors(t *testing.T) {
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 3,
+	}
+
+	// Every request fails to connect
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}))
+	server.Close()
+
+	lock := sync.Mutex{}
+	tested := 0
+	requests := make([]*http.Request, settings.ThreadCount)
+	tests := make([]kurl.Test, settings.ThreadCount)
+	for i := 0; i < settings.ThreadCount; i++ {
+		var err error
+		requests[i], err = http.NewRequest("GET", server.URL, nil)
+		require.Nil(t, err)
+
+		tests[i] = kurl.Test(func(resp *http.Response, latency time.Duration) error {
+			lock.Lock()
+			tested++
+			lock.Unlock()
+			return nil
+		})
+	}
+
+	result, err := kurl.DoManyTest(
+		settings,
+		requests,
+		tests,
+	)
+
+	// A Test only runs on the responses of completed requests
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.ErrorCount)
+	assert.Equal(t, 0, tested)
+	assert.Equal(t, 0, result.Failures.Count)
+}
+
 func TestWaitBetweenRequests(t *testing.T) {
 
 	hasSeenFirstRequest := false
@@ -298,25 +341,28 @@ func TestWaitBetweenRequests(t *testing.T) {
 
 func TestWarm(t *testing.T) {
 	lock := sync.Mutex{}
-	seenWarm := false
+	received := 0
 
 	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		assert.Nil(t, err)
 
 		lock.Lock()
-		if !seenWarm {
-			assert.Equal(t, "GET", req.Method, "Server is not receiving test requests before warmup!")
-			seenWarm = true
-		} else {
-			assert.Equal(t, "POST", req.Method, "Server did not receive a warmup!")
-		}
+		received++
 		lock.Unlock()
 
+		// The warmup request is the same as the measured requests
+		assert.Equal(t, "PUT", req.Method)
+		assert.Equal(t, "yes", req.Header.Get("X-Test"))
+		assert.Equal(t, "payload", string(body))
 		rw.Write([]byte(`OK`))
 	}))
 	defer server.Close()
 
-	request, err := http.NewRequest("POST", server.URL, nil)
+	request, err := http.NewRequest("PUT", server.URL, nil)
 	require.Nil(t, err)
+	request.Header.Set("X-Test", "yes")
+	kurl.SetBody(request, []byte("payload"))
 
 	settings := kurl.Settings{
 		Warm:         true,
@@ -333,6 +379,130 @@ func TestWarm(t *testing.T) {
 	assert.Equal(t, 0, result.ErrorCount)
 	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.CompletedCount)
 	assert.Equal(t, result.CompletedCount, result.StatusCodesFrequency[http.StatusOK])
+	assert.Equal(t, result.CompletedCount+settings.ThreadCount, received, "Server did not receive a warmup per thread!")
+}
+
+func TestWarmCount(t *testing.T) {
+	lock := sync.Mutex{}
+	received := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		received++
+		lock.Unlock()
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	for _, rate := range []float64{0, 1000} {
+		received = 0
+		settings := kurl.Settings{
+			WarmCount:    3,
+			ThreadCount:  4,
+			RequestCount: 2,
+			Rate:         rate,
+		}
+
+		result, err := kurl.Do(
+			settings,
+			*request,
+		)
+		assert.Nil(t, err)
+		require.NotNil(t, result)
+		assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+		assert.Equal(t, result.CompletedCount+settings.ThreadCount*settings.WarmCount, received)
+	}
+}
+
+func TestWarmDuration(t *testing.T) {
+	lock := sync.Mutex{}
+	received := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		lock.Lock()
+		received++
+		lock.Unlock()
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		WarmDuration: 100 * time.Millisecond,
+		ThreadCount:  2,
+		RequestCount: 1,
+	}
+
+	start := time.Now()
+	result, err := kurl.Do(
+		settings,
+		*request,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+	assert.Less(t, result.CompletedCount+settings.ThreadCount, received)
+	assert.LessOrEqual(t, int64(settings.WarmDuration), int64(time.Since(start)-result.OverallDuration))
+}
+
+func TestWarmTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		Warm:         true,
+		Timeout:      10 * time.Millisecond,
+		ThreadCount:  2,
+		RequestCount: 1,
+	}
+
+	result, err := kurl.Do(
+		settings,
+		*request,
+	)
+	require.NotNil(t, err)
+	assert.Equal(t, "Warm failed: ", err.Error()[0:13])
+	assert.Nil(t, result)
+}
+
+func TestMethods(t *testing.T) {
+	for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"} {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			assert.Equal(t, method, req.Method)
+			rw.Write([]byte(`OK`))
+		}))
+
+		request, err := http.NewRequest(method, server.URL, nil)
+		require.Nil(t, err)
+
+		settings := kurl.Settings{
+			Warm:         true,
+			ThreadCount:  2,
+			RequestCount: 2,
+		}
+
+		result, err := kurl.Do(
+			settings,
+			*request,
+		)
+		assert.Nil(t, err, method)
+		require.NotNil(t, result, method)
+		assert.Equal(t, 0, result.ErrorCount, method)
+		assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.StatusCodesFrequency[http.StatusOK], method)
+		server.Close()
+	}
 }
 
 func TestWarmFailed(t *testing.T) {
@@ -353,3 +523,32 @@ func TestWarmFailed(t *testing.T) {
 	assert.Equal(t, "Warm failed: ", err.Error()[0:13])
 	assert.Nil(t, result)
 }
+
+func TestDuration(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  3,
+		RequestCount: 1,
+		Duration:     200 * time.Millisecond,
+	}
+
+	result, err := kurl.Do(
+		settings,
+		*request,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 0, result.ErrorCount)
+	assert.Less(t, settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+	assert.Equal(t, result.CompletedCount, len(result.Latencies))
+	assert.Equal(t, result.CompletedCount, result.StatusCodesFrequency[http.StatusOK])
+	assert.LessOrEqual(t, int64(settings.Duration), int64(result.OverallDuration))
+}
@@ -0,0 +1,113 @@
+package kurl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// ErrorCategory classifies the error of a request which did not receive an HTTP response.
+type ErrorCategory string
+
+// The categories of errors reported in Result.Errors.
+const (
+	ErrorTimeout ErrorCategory = "timeout" // the request, or one of its phases, timed out
+	ErrorDNS     ErrorCategory = "dns"     // the host name could not be resolved
+	ErrorDial    ErrorCategory = "dial"    // the connection could not be established, e.g. connection refused
+	ErrorTLS     ErrorCategory = "tls"     // the TLS handshake failed, e.g. untrusted certificate
+	ErrorReset   ErrorCategory = "reset"   // the connection was reset by the peer
+	ErrorEOF     ErrorCategory = "eof"     // the connection was closed before the response was received
+	ErrorOther   ErrorCategory = "other"
+)
+
+// MaxErrorSamples is the maximum number of distinct error messages kept per category.
+const MaxErrorSamples = 3
+
+// ErrorSummary counts the errors of one category, with a few sample messages.
+type ErrorSummary struct {
+	Count   int      `json:"count"`
+	Samples []string `json:"samples"` // up to MaxErrorSamples distinct error messages
+}
+
+// ClassifyError returns the category of an error returned by http.Client.Do.
+func ClassifyError(err error) ErrorCategory {
+	var dnsError *net.DNSError
+	if errors.As(err, &dnsError) {
+		return ErrorDNS
+	}
+
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return ErrorTimeout
+	}
+
+	var recordHeaderError tls.RecordHeaderError
+	var unknownAuthorityError x509.UnknownAuthorityError
+	var hostnameError x509.HostnameError
+	var certificateInvalidError x509.CertificateInvalidError
+	if errors.As(err, &recordHeaderError) ||
+		errors.As(err, &unknownAuthorityError) ||
+		errors.As(err, &hostnameError) ||
+		errors.As(err, &certificateInvalidError) ||
+		strings.Contains(err.Error(), "tls: ") { // TLS alerts are not exported
+		return ErrorTLS
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return ErrorReset
+	}
+
+	var opError *net.OpError
+	if errors.As(err, &opError) && opError.Op == "dial" {
+		return ErrorDial
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrorEOF
+	}
+
+	return ErrorOther
+}
+
+// addError records one more error in a map of error summaries.
+func addError(summaries map[ErrorCategory]ErrorSummary, err error) {
+	category := ClassifyError(err)
+	summary := summaries[category]
+	summary.Count++
+	summary.Samples = addSample(summary.Samples, err.Error())
+	summaries[category] = summary
+}
+
+// mergeErrors adds all the errors of from into to.
+func mergeErrors(to map[ErrorCategory]ErrorSummary, from map[ErrorCategory]ErrorSummary) {
+	for category, fromSummary := range from {
+		summary := to[category]
+		mergeSummary(&summary, fromSummary)
+		to[category] = summary
+	}
+}
+
+// mergeSummary adds the count and the samples of from into to.
+func mergeSummary(to *ErrorSummary, from ErrorSummary) {
+	to.Count += from.Count
+	for _, sample := range from.Samples {
+		to.Samples = addSample(to.Samples, sample)
+	}
+}
+
+// addSample adds a message to samples, unless it is already there or there are enough samples.
+func addSample(samples []string, message string) []string {
+	if len(samples) >= MaxErrorSamples {
+		return samples
+	}
+	for _, sample := range samples {
+		if sample == message {
+			return samples
+		}
+	}
+	return append(samples, message)
+}
@@ -0,0 +1,101 @@
+package kurl_test
+
+import (
+	"crypto/x509"
+	"errors"
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func urlError(err error) error {
+	return &url.Error{Op: "Get", URL: "http://localhost", Err: err}
+}
+
+func TestClassifyError(t *testing.T) {
+	dial := &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}
+
+	assert.Equal(t, kurl.ErrorDNS, kurl.ClassifyError(urlError(&net.OpError{Op: "dial", Err: &net.DNSError{Name: "nowhere"}})))
+	assert.Equal(t, kurl.ErrorDNS, kurl.ClassifyError(urlError(&net.DNSError{IsTimeout: true}))) // DNS takes precedence
+	assert.Equal(t, kurl.ErrorDial, kurl.ClassifyError(urlError(dial)))
+	assert.Equal(t, kurl.ErrorTLS, kurl.ClassifyError(urlError(x509.UnknownAuthorityError{})))
+	assert.Equal(t, kurl.ErrorTLS, kurl.ClassifyError(urlError(errors.New("remote error: tls: bad certificate"))))
+	assert.Equal(t, kurl.ErrorReset, kurl.ClassifyError(urlError(reset)))
+	assert.Equal(t, kurl.ErrorEOF, kurl.ClassifyError(urlError(io.EOF)))
+	assert.Equal(t, kurl.ErrorEOF, kurl.ClassifyError(urlError(io.ErrUnexpectedEOF)))
+	assert.Equal(t, kurl.ErrorOther, kurl.ClassifyError(urlError(errors.New("unsupported protocol scheme"))))
+}
+
+func TestErrors(t *testing.T) {
+	// The server closes connections without responding
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		conn, _, err := rw.(http.Hijacker).Hijack()
+		require.Nil(t, err)
+		conn.Close()
+	}))
+	defer server.Close()
+
+	// Nothing is listening on the address of a closed server
+	closed := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}))
+	closed.Close()
+
+	eof, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+	refused, err := http.NewRequest("GET", closed.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 5,
+	}
+
+	result, err := kurl.DoMany(
+		settings,
+		[]*http.Request{eof, refused},
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 0, result.CompletedCount)
+	assert.Equal(t, 10, result.ErrorCount)
+	require.Equal(t, 2, len(result.Errors))
+	assert.Equal(t, 5, result.Errors[kurl.ErrorEOF].Count)
+	assert.Equal(t, 5, result.Errors[kurl.ErrorDial].Count)
+	assert.Equal(t, 1, len(result.Errors[kurl.ErrorDial].Samples))
+	assert.Contains(t, result.Errors[kurl.ErrorDial].Samples[0], "connection refused")
+}
+
+func TestErrorsTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 1,
+		Timeout:      10 * time.Millisecond,
+	}
+
+	result, err := kurl.Do(
+		settings,
+		*request,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 2, result.ErrorCount)
+	assert.Equal(t, 2, result.Errors[kurl.ErrorTimeout].Count)
+}
@@ -0,0 +1,203 @@
+package kurl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// FeedMode is how the threads of a run take the rows of a Feeder. In every mode, rows wrap around.
+type FeedMode string
+
+// The modes of a Feeder.
+const (
+	FeedSequential  FeedMode = "sequential"  // the threads take the rows in order, each row going to the next thread in need
+	FeedRandom      FeedMode = "random"      // each thread takes random rows
+	FeedPartitioned FeedMode = "partitioned" // each thread cycles over its own share of the rows, which no other thread uses
+)
+
+// Feeder provides rows of data to the threads of a scenario. Before every run of the scenario, a thread takes
+// a row and sets its fields as variables, which the templates of the steps use as {{.field}}. The fields of
+// the previous row which the row lacks go back to their value in Scenario.Variables, or are removed.
+// Every run, such as each run of a Search, takes the rows from the first ones, and so does the measured part
+// of a run after its warm-up.
+type Feeder struct {
+	rows []map[string]string
+	mode FeedMode
+}
+
+// NewFeeder returns a feeder of rows, given as field values keyed by field name.
+func NewFeeder(rows []map[string]string, mode FeedMode) (*Feeder, error) {
+	if len(rows) == 0 {
+		return nil, errors.New("A feeder must have at least one row")
+	}
+	switch mode {
+	case FeedSequential, FeedRandom, FeedPartitioned:
+	default:
+		return nil, errors.New("The feed mode must be sequential, random or partitioned")
+	}
+
+	return &Feeder{rows: rows, mode: mode}, nil
+}
+
+// ReadCSVFeeder returns a feeder of the rows of a CSV document, whose first row holds the field names.
+func ReadCSVFeeder(r io.Reader, mode FeedMode) (*Feeder, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("A CSV feeder must start with a row of field names")
+	}
+
+	names := records[0]
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]string)
+		for i, name := range names {
+			row[name] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return NewFeeder(rows, mode)
+}
+
+// ReadJSONLFeeder returns a feeder of the rows of a JSON Lines document, where each line is an object.
+// Strings are fed as they are, other values as JSON.
+func ReadJSONLFeeder(r io.Reader, mode FeedMode) (*Feeder, error) {
+	var rows []map[string]string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(text))
+		decoder.UseNumber()
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err != nil {
+			return nil, errors.New("Invalid JSON on line " + strconv.Itoa(line) + ": " + err.Error())
+		}
+		row := make(map[string]string)
+		for name, value := range object {
+			row[name], _ = jsonString(value)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewFeeder(rows, mode)
+}
+
+// LoadFeeder returns a feeder of the rows of a .csv, or of a .jsonl or .ndjson file.
+func LoadFeeder(filename string, mode FeedMode) (*Feeder, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return ReadCSVFeeder(file, mode)
+	case ".jsonl", ".ndjson":
+		return ReadJSONLFeeder(file, mode)
+	default:
+		return nil, errors.New("The feeder file must be .csv, .jsonl or .ndjson")
+	}
+}
+
+// Len returns the number of rows of the feeder.
+func (feeder *Feeder) Len() int {
+	return len(feeder.rows)
+}
+
+// feed is the view of a feeder by one thread.
+type feed struct {
+	feeder      *Feeder
+	thread      int
+	threadCount int
+	cursor      *uint64           // index of the next row in sequential mode, shared by the threads of a run
+	random      *rand.Rand        // nil unless in random mode
+	partition   int               // index of the next row of the thread in partitioned mode
+	variables   map[string]string // initial variables of the thread, restored when the next row does not set them
+	row         map[string]string // last row set in the variables of the thread
+}
+
+// forThreads returns the views of the feeder by the threadCount threads of a run, whose initial variables
+// are variables. Each run starts from the first rows, whichever rows the previous runs took.
+func (feeder *Feeder) forThreads(threadCount int, variables map[string]string) ([]*feed, error) {
+	if feeder.mode == FeedPartitioned && len(feeder.rows) < threadCount {
+		return nil, errors.New("A partitioned feeder must have at least one row per thread")
+	}
+	cursor := new(uint64)
+	feeds := make([]*feed, threadCount)
+	for i := range feeds {
+		feeds[i] = &feed{
+			feeder:      feeder,
+			cursor:      cursor,
+			thread:      i,
+			threadCount: threadCount,
+			variables:   variables,
+			partition:   i,
+		}
+		if feeder.mode == FeedRandom {
+			feeds[i].random = rand.New(rand.NewSource(time.Now().UnixNano() + int64(i)))
+		}
+	}
+	return feeds, nil
+}
+
+// rewind makes the thread take its rows from the first ones again, such as after the warm-up.
+func (f *feed) rewind() {
+	atomic.StoreUint64(f.cursor, 0)
+	f.partition = f.thread
+}
+
+// next sets the fields of the next row of the thread in vars, in place of the fields of its last row.
+func (f *feed) next(vars map[string]string) {
+	rows := f.feeder.rows
+	var row map[string]string
+	switch f.feeder.mode {
+	case FeedRandom:
+		row = rows[f.random.Intn(len(rows))]
+	case FeedPartitioned:
+		// Thread i takes rows i, i+threadCount, i+2*threadCount...
+		row = rows[f.partition]
+		f.partition += f.threadCount
+		if f.partition >= len(rows) {
+			f.partition %= f.threadCount
+		}
+	default:
+		row = rows[(atomic.AddUint64(f.cursor, 1)-1)%uint64(len(rows))]
+	}
+
+	// The fields of the last row which the next row lacks go back to their initial value, or are removed
+	for name := range f.row {
+		if _, ok := row[name]; ok {
+			continue
+		}
+		if value, ok := f.variables[name]; ok {
+			vars[name] = value
+		} else {
+			delete(vars, name)
+		}
+	}
+	for name, value := range row {
+		vars[name] = value
+	}
+	f.row = row
+}
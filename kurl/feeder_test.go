@@ -0,0 +1,210 @@
+package kurl_test
+
+import (
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newFeedServer counts the requests received for each user.
+func newFeedServer(t *testing.T) (*httptest.Server, map[string]int) {
+	lock := sync.Mutex{}
+	users := make(map[string]int)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		assert.Nil(t, err)
+		user := strings.TrimPrefix(req.URL.Path, "/users/")
+		assert.Equal(t, user, req.Header.Get("X-User"))
+		assert.Equal(t, `{"user": "`+user+`"}`, string(body))
+
+		lock.Lock()
+		users[user]++
+		lock.Unlock()
+		rw.Write([]byte(`OK`))
+	}))
+	return server, users
+}
+
+func feedScenario(server *httptest.Server, feeder *kurl.Feeder) kurl.Scenario {
+	return kurl.Scenario{
+		Steps: []kurl.Step{{
+			Method:  "PUT",
+			URL:     server.URL + "/users/{{.user}}",
+			Headers: map[string]string{"X-User": "{{.user}}"},
+			Body:    `{"user": "{{.user}}"}`,
+		}},
+		Feeder: feeder,
+	}
+}
+
+func TestFeederSequential(t *testing.T) {
+	server, users := newFeedServer(t)
+	defer server.Close()
+
+	feeder, err := kurl.ReadCSVFeeder(strings.NewReader("user,name\na,Alice\nb,Bob\nc,Carol\n"), kurl.FeedSequential)
+	require.Nil(t, err)
+	assert.Equal(t, 3, feeder.Len())
+
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 3,
+	}
+	result, err := kurl.DoScenario(settings, feedScenario(server, feeder))
+	require.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 0, result.ErrorCount)
+	assert.Equal(t, map[string]int{"a": 2, "b": 2, "c": 2}, users)
+}
+
+func TestFeederFirstRows(t *testing.T) {
+	server, users := newFeedServer(t)
+	defer server.Close()
+
+	feeder, err := kurl.ReadCSVFeeder(strings.NewReader("user\na\nb\nc\n"), kurl.FeedSequential)
+	require.Nil(t, err)
+
+	// The warm-up takes row a, and the measured run takes rows a and b again
+	settings := kurl.Settings{
+		ThreadCount:  1,
+		RequestCount: 2,
+		Warm:         true,
+	}
+	result, err := kurl.DoScenario(settings, feedScenario(server, feeder))
+	require.Nil(t, err)
+	assert.Equal(t, 0, result.ErrorCount)
+	assert.Equal(t, map[string]int{"a": 2, "b": 1}, users)
+
+	// Another run of the same feeder starts from row a as well
+	settings.Warm = false
+	result, err = kurl.DoScenario(settings, feedScenario(server, feeder))
+	require.Nil(t, err)
+	assert.Equal(t, 0, result.ErrorCount)
+	assert.Equal(t, map[string]int{"a": 3, "b": 2}, users)
+}
+
+func TestFeederPartitioned(t *testing.T) {
+	server, users := newFeedServer(t)
+	defer server.Close()
+
+	feeder, err := kurl.ReadJSONLFeeder(strings.NewReader("{\"user\": \"a\"}\n{\"user\": \"b\"}\n\n{\"user\": \"c\"}\n"), kurl.FeedPartitioned)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 4,
+	}
+	result, err := kurl.DoScenario(settings, feedScenario(server, feeder))
+	require.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 0, result.ErrorCount)
+
+	// The first thread takes rows a and c, the second thread row b only
+	assert.Equal(t, map[string]int{"a": 2, "b": 4, "c": 2}, users)
+
+	settings.ThreadCount = 4
+	_, err = kurl.DoScenario(settings, feedScenario(server, feeder))
+	assert.NotNil(t, err)
+}
+
+func TestFeederRandom(t *testing.T) {
+	server, users := newFeedServer(t)
+	defer server.Close()
+
+	feeder, err := kurl.NewFeeder([]map[string]string{{"user": "a"}, {"user": "b"}}, kurl.FeedRandom)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 50,
+		Warm:         true,
+	}
+	result, err := kurl.DoScenario(settings, feedScenario(server, feeder))
+	require.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 0, result.ErrorCount)
+	assert.Equal(t, 2, len(users))
+	assert.Equal(t, settings.ThreadCount*(settings.RequestCount+1), users["a"]+users["b"])
+}
+
+func TestFeederDifferentFields(t *testing.T) {
+	lock := sync.Mutex{}
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		received = append(received, req.URL.Path+" "+req.Header.Get("X-Role")+" "+req.Header.Get("X-Token"))
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	feeder, err := kurl.ReadJSONLFeeder(strings.NewReader(
+		`{"user": "a", "role": "admin", "token": "t"}`+"\n"+
+			`{"user": "b", "token": "u"}`+"\n"+
+			`{"user": "c"}`+"\n"), kurl.FeedSequential)
+	require.Nil(t, err)
+
+	scenario := kurl.Scenario{
+		Variables: map[string]string{"role": "guest"},
+		Steps: []kurl.Step{{
+			URL:     server.URL + "/{{.user}}",
+			Headers: map[string]string{"X-Role": "{{.role}}", "X-Token": "{{.token}}"},
+		}},
+		Feeder: feeder,
+	}
+	settings := kurl.Settings{
+		ThreadCount:  1,
+		RequestCount: 3,
+	}
+	result, err := kurl.DoScenario(settings, scenario)
+	require.Nil(t, err)
+	require.NotNil(t, result)
+
+	// A field of the previous row goes back to its initial value, or fails the template without one
+	assert.Equal(t, []string{"/a admin t", "/b guest u"}, received)
+	assert.Equal(t, 1, result.ErrorCount)
+}
+
+func TestInvalidFeeder(t *testing.T) {
+	_, err := kurl.NewFeeder(nil, kurl.FeedSequential)
+	assert.NotNil(t, err)
+
+	_, err = kurl.NewFeeder([]map[string]string{{"user": "a"}}, "shuffled")
+	assert.NotNil(t, err)
+
+	_, err = kurl.ReadCSVFeeder(strings.NewReader("user,name\na\n"), kurl.FeedSequential)
+	assert.NotNil(t, err)
+
+	_, err = kurl.ReadJSONLFeeder(strings.NewReader("{\"user\": \"a\"}\nuser: b\n"), kurl.FeedSequential)
+	assert.NotNil(t, err)
+}
+
+func TestLoadFeeder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kurl")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	csvFile := filepath.Join(dir, "users.csv")
+	require.Nil(t, ioutil.WriteFile(csvFile, []byte("user\na\nb\n"), 0644))
+	feeder, err := kurl.LoadFeeder(csvFile, kurl.FeedSequential)
+	require.Nil(t, err)
+	assert.Equal(t, 2, feeder.Len())
+
+	jsonlFile := filepath.Join(dir, "users.jsonl")
+	require.Nil(t, ioutil.WriteFile(jsonlFile, []byte(`{"user": "a", "id": 7, "tags": ["x"]}`), 0644))
+	feeder, err = kurl.LoadFeeder(jsonlFile, kurl.FeedSequential)
+	require.Nil(t, err)
+	assert.Equal(t, 1, feeder.Len())
+
+	txtFile := filepath.Join(dir, "users.txt")
+	require.Nil(t, ioutil.WriteFile(txtFile, []byte("a\n"), 0644))
+	_, err = kurl.LoadFeeder(txtFile, kurl.FeedSequential)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,243 @@
+package kurl
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// DefaultHistogramMax is the highest latency tracked by a histogram when none is specified.
+const DefaultHistogramMax = time.Hour
+
+// defaultHistogramPrecision is the number of significant digits of histograms kurl needs for its own statistics.
+const defaultHistogramPrecision = 3
+
+// Histogram records latencies in bounded memory, with a configurable number of significant digits,
+// following the bucketing scheme of HdrHistogram (http://hdrhistogram.org).
+// Latencies are tracked with a resolution of one microsecond, latencies above the maximum are clamped.
+// The buckets are allocated as latencies are recorded, up to the highest one, so that an unused histogram
+// is almost free, and a histogram of latencies of milliseconds takes tens of kilobytes whatever its maximum.
+// A Histogram is not safe for concurrent use.
+type Histogram struct {
+	precision                   int
+	max                         int64 // highest trackable value in microseconds
+	subBucketHalfCountMagnitude uint
+	subBucketHalfCount          int
+	subBucketMask               int64
+	length                      int     // number of counts covering max
+	counts                      []int64 // the first counts, up to the highest value recorded
+
+	totalCount int64
+	minValue   int64
+	maxValue   int64
+	sum        float64 // sum of the recorded values, in microseconds
+	sumSquares float64 // sum of the squares of the recorded values, in microseconds squared
+}
+
+// NewHistogram creates an empty histogram with precision significant digits (1 to 5),
+// tracking latencies up to max.
+func NewHistogram(precision int, max time.Duration) (*Histogram, error) {
+	if precision < 1 || precision > 5 {
+		return nil, errors.New("The histogram precision must be between 1 and 5 significant digits")
+	}
+	if max < time.Microsecond {
+		return nil, errors.New("The histogram maximum must be at least 1 microsecond")
+	}
+
+	h := &Histogram{
+		precision: precision,
+		max:       max.Microseconds(),
+	}
+
+	largestValueWithSingleUnitResolution := 2 * math.Pow10(precision)
+	subBucketCountMagnitude := uint(math.Ceil(math.Log2(largestValueWithSingleUnitResolution)))
+	h.subBucketHalfCountMagnitude = subBucketCountMagnitude - 1
+	subBucketCount := int64(1) << subBucketCountMagnitude
+	h.subBucketHalfCount = int(subBucketCount / 2)
+	h.subBucketMask = subBucketCount - 1
+
+	// Each bucket doubles the range of the previous one, until max is covered
+	bucketCount := 1
+	for smallestUntrackableValue := subBucketCount; smallestUntrackableValue <= h.max; smallestUntrackableValue <<= 1 {
+		bucketCount++
+	}
+	h.length = (bucketCount + 1) * h.subBucketHalfCount
+	return h, nil
+}
+
+// grow allocates the counts up to index i, a half bucket at a time.
+func (h *Histogram) grow(i int) {
+	length := (i/h.subBucketHalfCount + 1) * h.subBucketHalfCount
+	if length > h.length {
+		length = h.length
+	}
+	counts := make([]int64, length)
+	copy(counts, h.counts)
+	h.counts = counts
+}
+
+// Record adds one latency to the histogram.
+func (h *Histogram) Record(latency time.Duration) {
+	h.recordValues(latency.Microseconds(), 1)
+}
+
+func (h *Histogram) recordValues(value int64, count int64) {
+	if value < 0 {
+		value = 0
+	} else if value > h.max {
+		value = h.max
+	}
+
+	i := h.countsIndex(value)
+	if i >= len(h.counts) {
+		h.grow(i)
+	}
+	h.counts[i] += count
+	if h.totalCount == 0 || value < h.minValue {
+		h.minValue = value
+	}
+	if value > h.maxValue {
+		h.maxValue = value
+	}
+	h.totalCount += count
+	h.sum += float64(value) * float64(count)
+	h.sumSquares += float64(value) * float64(value) * float64(count)
+}
+
+// Merge adds all the latencies recorded in other to this histogram.
+func (h *Histogram) Merge(other *Histogram) {
+	if other == nil || other.totalCount == 0 {
+		return
+	}
+
+	if h.precision == other.precision && h.length == other.length {
+		if len(other.counts) > len(h.counts) {
+			h.grow(len(other.counts) - 1)
+		}
+		for i, count := range other.counts {
+			h.counts[i] += count
+		}
+		if h.totalCount == 0 || other.minValue < h.minValue {
+			h.minValue = other.minValue
+		}
+		if other.maxValue > h.maxValue {
+			h.maxValue = other.maxValue
+		}
+		h.totalCount += other.totalCount
+		h.sum += other.sum
+		h.sumSquares += other.sumSquares
+		return
+	}
+
+	// Different layouts: re-record the values of every bucket
+	for i, count := range other.counts {
+		if count != 0 {
+			h.recordValues(other.valueFromIndex(i), count)
+		}
+	}
+}
+
+// Reset removes all the latencies recorded.
+func (h *Histogram) Reset() {
+	for i := range h.counts {
+		h.counts[i] = 0
+	}
+	h.totalCount = 0
+	h.minValue = 0
+	h.maxValue = 0
+	h.sum = 0
+	h.sumSquares = 0
+}
+
+// Count returns the number of latencies recorded.
+func (h *Histogram) Count() int {
+	return int(h.totalCount)
+}
+
+// Min returns the smallest latency recorded.
+func (h *Histogram) Min() time.Duration {
+	return time.Duration(h.minValue) * time.Microsecond
+}
+
+// Max returns the largest latency recorded.
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.maxValue) * time.Microsecond
+}
+
+// Mean returns the average latency recorded.
+func (h *Histogram) Mean() time.Duration {
+	if h.totalCount == 0 {
+		return 0
+	}
+	return time.Duration(h.sum/float64(h.totalCount)) * time.Microsecond
+}
+
+// StdDev returns the sample standard deviation of the latencies recorded.
+func (h *Histogram) StdDev() time.Duration {
+	if h.totalCount < 2 {
+		return 0
+	}
+	n := float64(h.totalCount)
+	variance := (h.sumSquares - h.sum*h.sum/n) / (n - 1)
+	if variance < 0 {
+		variance = 0
+	}
+	return time.Duration(math.Sqrt(variance)) * time.Microsecond
+}
+
+// Percentile returns the latency below which the fraction p of recorded latencies fall, with p in [0, 1].
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.totalCount == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p * float64(h.totalCount)))
+	if rank < 1 {
+		rank = 1
+	} else if rank > h.totalCount {
+		rank = h.totalCount
+	}
+
+	var cumulative int64
+	for i, count := range h.counts {
+		cumulative += count
+		if cumulative >= rank {
+			value := h.highestEquivalentValue(h.valueFromIndex(i))
+			if value > h.maxValue {
+				value = h.maxValue
+			} else if value < h.minValue {
+				value = h.minValue
+			}
+			return time.Duration(value) * time.Microsecond
+		}
+	}
+	return h.Max()
+}
+
+func (h *Histogram) bucketIndex(value int64) int {
+	pow2Ceiling := 64 - bits.LeadingZeros64(uint64(value|h.subBucketMask))
+	return pow2Ceiling - int(h.subBucketHalfCountMagnitude) - 1
+}
+
+func (h *Histogram) countsIndex(value int64) int {
+	bucketIndex := h.bucketIndex(value)
+	subBucketIndex := int(value >> uint(bucketIndex))
+	return ((bucketIndex + 1) << h.subBucketHalfCountMagnitude) + (subBucketIndex - h.subBucketHalfCount)
+}
+
+// valueFromIndex returns the lowest value which falls into the counts at index i.
+func (h *Histogram) valueFromIndex(i int) int64 {
+	bucketIndex := (i >> h.subBucketHalfCountMagnitude) - 1
+	subBucketIndex := (i & (h.subBucketHalfCount - 1)) + h.subBucketHalfCount
+	if bucketIndex < 0 {
+		subBucketIndex -= h.subBucketHalfCount
+		bucketIndex = 0
+	}
+	return int64(subBucketIndex) << uint(bucketIndex)
+}
+
+// highestEquivalentValue returns the highest value which falls into the same counts as value.
+func (h *Histogram) highestEquivalentValue(value int64) int64 {
+	bucketIndex := h.bucketIndex(value)
+	return value + (int64(1) << uint(bucketIndex)) - 1
+}
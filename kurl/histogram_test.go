@@ -0,0 +1,159 @@
+package kurl_test
+
+import (
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h, err := kurl.NewHistogram(3, time.Minute)
+	require.Nil(t, err)
+
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	assert.Equal(t, 10000, h.Count())
+	assert.Equal(t, 1*time.Millisecond, h.Min())
+	assert.Equal(t, 10*time.Second, h.Max())
+	assert.InDelta(t, float64(5000500*time.Microsecond), float64(h.Mean()), float64(time.Microsecond))
+	assert.InDelta(t, float64(2886896*time.Microsecond), float64(h.StdDev()), float64(time.Millisecond))
+
+	// 3 significant digits means a relative error of at most 0.1%
+	for _, p := range []float64{0.5, 0.9, 0.99, 0.999} {
+		expected := float64(time.Duration(p*10000) * time.Millisecond)
+		assert.InEpsilon(t, expected, float64(h.Percentile(p)), 0.001)
+	}
+	assert.Equal(t, 1*time.Millisecond, h.Percentile(0))
+	assert.Equal(t, 10*time.Second, h.Percentile(1))
+}
+
+func TestHistogramClampsToMax(t *testing.T) {
+	h, err := kurl.NewHistogram(2, time.Second)
+	require.Nil(t, err)
+
+	h.Record(time.Hour)
+	assert.Equal(t, 1, h.Count())
+	assert.Equal(t, time.Second, h.Max())
+	assert.Equal(t, time.Second, h.Percentile(0.5))
+}
+
+func TestHistogramMerge(t *testing.T) {
+	h1, err := kurl.NewHistogram(3, time.Minute)
+	require.Nil(t, err)
+	h2, err := kurl.NewHistogram(3, time.Minute)
+	require.Nil(t, err)
+	h3, err := kurl.NewHistogram(2, time.Hour)
+	require.Nil(t, err)
+
+	h1.Record(10 * time.Millisecond)
+	h2.Record(20 * time.Millisecond)
+	h3.Record(40 * time.Millisecond)
+
+	h1.Merge(h2)
+	h1.Merge(h3)
+	h1.Merge(nil)
+
+	assert.Equal(t, 3, h1.Count())
+	assert.Equal(t, 10*time.Millisecond, h1.Min())
+	assert.InEpsilon(t, float64(40*time.Millisecond), float64(h1.Max()), 0.01)
+	assert.InEpsilon(t, float64(20*time.Millisecond), float64(h1.Percentile(0.5)), 0.001)
+}
+
+func TestHistogramMergeLarger(t *testing.T) {
+	h1, err := kurl.NewHistogram(3, time.Hour)
+	require.Nil(t, err)
+	h2, err := kurl.NewHistogram(3, time.Hour)
+	require.Nil(t, err)
+
+	// The buckets of h2 go beyond those of h1, and those of the empty histogram
+	h1.Record(time.Millisecond)
+	h2.Record(10 * time.Minute)
+	empty, err := kurl.NewHistogram(3, time.Hour)
+	require.Nil(t, err)
+	empty.Merge(h2)
+	h2.Merge(h1)
+	h1.Merge(empty)
+
+	for _, h := range []*kurl.Histogram{h1, h2} {
+		assert.Equal(t, 2, h.Count())
+		assert.Equal(t, time.Millisecond, h.Percentile(0.5))
+		assert.InEpsilon(t, float64(10*time.Minute), float64(h.Percentile(1)), 0.001)
+	}
+}
+
+func TestHistogramMemory(t *testing.T) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	// Unused histograms, and histograms of millisecond latencies, take little memory whatever their maximum
+	histograms := make([]*kurl.Histogram, 1000)
+	for i := range histograms {
+		histograms[i], _ = kurl.NewHistogram(3, time.Hour)
+		if i%2 == 0 {
+			histograms[i].Record(time.Duration(i) * time.Microsecond)
+		}
+	}
+	runtime.ReadMemStats(&after)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(20<<20))
+	runtime.KeepAlive(histograms)
+}
+
+func TestHistogramBadPrecision(t *testing.T) {
+	h, err := kurl.NewHistogram(6, time.Minute)
+	require.NotNil(t, err)
+	assert.Equal(t, "The histogram precision must be between 1 and 5 significant digits", err.Error())
+	assert.Nil(t, h)
+}
+
+func TestDoHistogram(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:        5,
+		RequestCount:       20,
+		HistogramPrecision: 3,
+	}
+
+	result, err := kurl.Do(
+		settings,
+		*request,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 0, result.ErrorCount)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+	assert.Nil(t, result.Latencies)
+	require.NotNil(t, result.Histogram)
+	assert.Equal(t, result.CompletedCount, result.Histogram.Count())
+	assert.Equal(t, result.Histogram.Percentile(0.99), result.Percentile(0.99))
+}
+
+func TestDoHistogramBadPrecision(t *testing.T) {
+	request, err := http.NewRequest("GET", "http://localhost:9999", nil)
+	require.Nil(t, err)
+
+	result, err := kurl.Do(
+		kurl.Settings{
+			ThreadCount:        1,
+			RequestCount:       1,
+			HistogramPrecision: -1,
+		},
+		*request,
+	)
+	require.NotNil(t, err)
+	assert.Nil(t, result)
+}
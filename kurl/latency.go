@@ -0,0 +1,67 @@
+package kurl
+
+import (
+	"math"
+	"time"
+)
+
+// LatencyStats summarizes the latencies of the requests which completed.
+type LatencyStats struct {
+	Min    time.Duration
+	Mean   time.Duration
+	Max    time.Duration
+	StdDev time.Duration // sample standard deviation
+}
+
+// LatencyStats returns the min, mean, max and standard deviation of the latencies of completed requests.
+func (result *Result) LatencyStats() LatencyStats {
+	if result.Histogram != nil {
+		return result.Histogram.LatencyStats()
+	}
+
+	var stats LatencyStats
+	var sum time.Duration
+	completed := 0
+	for _, latency := range result.Latencies {
+		// Skip the flagged latencies which correspond to HTTP errors
+		if latency == 0 {
+			continue
+		}
+
+		completed++
+		sum += latency
+		if completed == 1 || latency < stats.Min {
+			stats.Min = latency
+		}
+		if latency > stats.Max {
+			stats.Max = latency
+		}
+	}
+	if completed == 0 {
+		return stats
+	}
+	stats.Mean = time.Duration(float64(sum) / float64(completed))
+
+	if completed > 1 {
+		var agg float64
+		for _, latency := range result.Latencies {
+			if latency == 0 {
+				continue
+			}
+			d := float64(latency - stats.Mean)
+			agg += d * d
+		}
+		stats.StdDev = time.Duration(math.Sqrt(agg / float64(completed-1)))
+	}
+	return stats
+}
+
+// LatencyStats returns the min, mean, max and standard deviation of the latencies recorded.
+func (h *Histogram) LatencyStats() LatencyStats {
+	return LatencyStats{
+		Min:    h.Min(),
+		Mean:   h.Mean(),
+		Max:    h.Max(),
+		StdDev: h.StdDev(),
+	}
+}
@@ -0,0 +1,47 @@
+package kurl_test
+
+import (
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLatencyStats(t *testing.T) {
+	result := kurl.Result{
+		Latencies: []time.Duration{
+			2 * time.Millisecond,
+			0, // errored
+			4 * time.Millisecond,
+			6 * time.Millisecond,
+		},
+	}
+
+	stats := result.LatencyStats()
+	assert.Equal(t, 2*time.Millisecond, stats.Min)
+	assert.Equal(t, 4*time.Millisecond, stats.Mean)
+	assert.Equal(t, 6*time.Millisecond, stats.Max)
+	assert.Equal(t, 2*time.Millisecond, stats.StdDev)
+}
+
+func TestLatencyStatsHistogram(t *testing.T) {
+	histogram, err := kurl.NewHistogram(3, time.Minute)
+	require.Nil(t, err)
+	histogram.Record(2 * time.Millisecond)
+	histogram.Record(4 * time.Millisecond)
+	histogram.Record(6 * time.Millisecond)
+
+	result := kurl.Result{Histogram: histogram}
+
+	stats := result.LatencyStats()
+	assert.Equal(t, 2*time.Millisecond, stats.Min)
+	assert.Equal(t, 4*time.Millisecond, stats.Mean)
+	assert.Equal(t, 6*time.Millisecond, stats.Max)
+	assert.Equal(t, 2*time.Millisecond, stats.StdDev)
+}
+
+func TestLatencyStatsEmpty(t *testing.T) {
+	result := kurl.Result{Latencies: []time.Duration{0}}
+	assert.Equal(t, kurl.LatencyStats{}, result.LatencyStats())
+}
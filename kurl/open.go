@@ -0,0 +1,86 @@
+package kurl
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// openWorker runs its flow once for every intended send time it receives from the schedule.
+func openWorker(
+	ctx context.Context,
+	flow *flow,
+	schedule <-chan time.Time,
+	complete *sync.WaitGroup,
+) {
+	defer complete.Done()
+
+	for intended := range schedule {
+		flow.run(ctx, intended)
+	}
+}
+
+// doOpenModel sends requests at settings.Rate on a fixed timeline, regardless of how long responses take.
+// Workers are spawned whenever a send is due and all existing workers are busy, up to settings.ThreadCount.
+// When that cap is reached sends are delayed, and that queueing delay is included in the latencies.
+func doOpenModel(
+	ctx context.Context,
+	settings Settings,
+	flows []*flow,
+	workerResults []workerResult,
+	timeSeries *timeSeries,
+) (*Result, error) {
+	schedule := make(chan time.Time)
+	var workersComplete sync.WaitGroup
+	spawned := 0
+	spawn := func() {
+		workersComplete.Add(1)
+		go openWorker(ctx, flows[spawned], schedule, &workersComplete)
+		spawned++
+	}
+
+	start := time.Now()
+	if timeSeries != nil {
+		timeSeries.start = start
+	}
+	stopProgress := startProgress(&settings, start, workerResults)
+dispatch:
+	for n := 0; ctx.Err() == nil; n++ {
+		intended := start.Add(time.Duration(float64(n) * float64(time.Second) / settings.Rate))
+		if settings.Duration > 0 {
+			if intended.Sub(start) >= settings.Duration {
+				break
+			}
+		} else if n >= settings.RequestCount*settings.ThreadCount {
+			break
+		}
+		sleep(ctx, time.Until(intended))
+
+		// Hand the send over to an idle worker, or spawn a new one if we're still allowed to
+		select {
+		case schedule <- intended:
+			continue
+		default:
+		}
+		if spawned < settings.ThreadCount {
+			spawn()
+		}
+		select {
+		case schedule <- intended:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(schedule)
+
+	// Wait until all workers are done
+	workersComplete.Wait()
+	elapsed := time.Since(start)
+	stopProgress()
+
+	// Aggregate statistics
+	result := aggregateResults(settings, elapsed, workerResults)
+	result.Interrupted = ctx.Err() != nil
+	result.Intervals = timeSeries.result(elapsed)
+	return &result, nil
+}
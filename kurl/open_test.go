@@ -0,0 +1,131 @@
+package kurl_test
+
+import (
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  10,
+		RequestCount: 4,
+		Rate:         100,
+	}
+
+	result, err := kurl.Do(
+		settings,
+		*request,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 0, result.ErrorCount)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+	assert.Equal(t, result.CompletedCount, result.StatusCodesFrequency[http.StatusOK])
+
+	// 40 requests at 100Hz are sent over 390ms
+	assert.LessOrEqual(t, int64(390*time.Millisecond), int64(result.OverallDuration))
+}
+
+func TestRateDuration(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount: 5,
+		Duration:    300 * time.Millisecond,
+		Rate:        50,
+	}
+
+	result, err := kurl.Do(
+		settings,
+		*request,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 0, result.ErrorCount)
+	assert.Equal(t, 15, result.CompletedCount)
+}
+
+func TestRateMeasuresQueueingDelay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	// A single connection cannot keep up with 100Hz when each response takes 50ms
+	settings := kurl.Settings{
+		ThreadCount:  1,
+		RequestCount: 10,
+		Rate:         100,
+	}
+
+	result, err := kurl.Do(
+		settings,
+		*request,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, settings.RequestCount, result.CompletedCount)
+
+	// The last request was meant to be sent at 90ms, but could only be sent after 9 responses of 50ms
+	last := result.Latencies[len(result.Latencies)-1]
+	assert.LessOrEqual(t, int64(400*time.Millisecond), int64(last))
+}
+
+func TestNegativeRate(t *testing.T) {
+	request, err := http.NewRequest("GET", "http://localhost:9999", nil)
+	require.Nil(t, err)
+
+	result, err := kurl.Do(
+		kurl.Settings{
+			ThreadCount:  1,
+			RequestCount: 1,
+			Rate:         -1,
+		},
+		*request,
+	)
+	require.NotNil(t, err)
+	assert.Equal(t, "settings.Rate cannot be negative", err.Error())
+	assert.Nil(t, result)
+}
+
+func TestRateWithoutThreads(t *testing.T) {
+	request, err := http.NewRequest("GET", "http://localhost:9999", nil)
+	require.Nil(t, err)
+
+	// No thread would ever take the scheduled sends
+	result, err := kurl.Do(
+		kurl.Settings{
+			ThreadCount: 0,
+			Duration:    time.Second,
+			Rate:        10,
+		},
+		*request,
+	)
+	require.NotNil(t, err)
+	assert.Equal(t, "settings.ThreadCount must be at least 1 with settings.Rate", err.Error())
+	assert.Nil(t, result)
+}
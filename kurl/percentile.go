@@ -0,0 +1,41 @@
+package kurl
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Percentile returns the latency below which the fraction p of successful requests fall, with p in [0, 1].
+// For example Percentile(0.99) is the 99th percentile latency. It returns 0 when no request completed.
+func (result *Result) Percentile(p float64) time.Duration {
+	if result.Histogram != nil {
+		return result.Histogram.Percentile(p)
+	}
+	if result.sortedLatencies == nil {
+		for _, latency := range result.Latencies {
+			// Skip the flagged latencies which correspond to HTTP errors
+			if latency != 0 {
+				result.sortedLatencies = append(result.sortedLatencies, latency)
+			}
+		}
+		sort.Slice(result.sortedLatencies, func(i, j int) bool {
+			return result.sortedLatencies[i] < result.sortedLatencies[j]
+		})
+	}
+	return percentile(result.sortedLatencies, p)
+}
+
+// percentile returns the nearest-rank percentile p of sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	} else if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,29 @@
+package kurl_test
+
+import (
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	result := kurl.Result{}
+	for i := 100; i > 0; i-- {
+		result.Latencies = append(result.Latencies, time.Duration(i)*time.Millisecond)
+	}
+	// Latencies of requests which errored are flagged with 0 and must be ignored
+	result.Latencies = append(result.Latencies, 0, 0, 0)
+
+	assert.Equal(t, 1*time.Millisecond, result.Percentile(0))
+	assert.Equal(t, 50*time.Millisecond, result.Percentile(0.5))
+	assert.Equal(t, 90*time.Millisecond, result.Percentile(0.9))
+	assert.Equal(t, 99*time.Millisecond, result.Percentile(0.99))
+	assert.Equal(t, 100*time.Millisecond, result.Percentile(0.999))
+	assert.Equal(t, 100*time.Millisecond, result.Percentile(1))
+}
+
+func TestPercentileNoLatencies(t *testing.T) {
+	result := kurl.Result{Latencies: []time.Duration{0, 0}}
+	assert.Equal(t, time.Duration(0), result.Percentile(0.5))
+}
@@ -0,0 +1,136 @@
+package kurl
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Phase is one of the steps of an HTTP request, timed when Settings.TracePhases is set.
+type Phase string
+
+// The phases of a request reported in Result.Phases.
+// DNS, connect and TLS phases only happen on requests which open a new connection.
+const (
+	PhaseDNS      Phase = "dns"      // resolving the host name
+	PhaseConnect  Phase = "connect"  // establishing the TCP connection
+	PhaseTLS      Phase = "tls"      // the TLS handshake
+	PhaseSend     Phase = "send"     // writing the request, from obtaining a connection to the request being written
+	PhaseWait     Phase = "wait"     // waiting for the server, from the request being written to the first response byte
+	PhaseTransfer Phase = "transfer" // reading the response, from the first to the last byte of the body
+)
+
+// Phases lists all phases in the order they happen.
+var Phases = []Phase{PhaseDNS, PhaseConnect, PhaseTLS, PhaseSend, PhaseWait, PhaseTransfer}
+
+// phaseTracer times the phases of the requests of one worker, one request at a time.
+type phaseTracer struct {
+	mutex     sync.Mutex // the transport may call the trace hooks from its own goroutines
+	durations map[Phase]time.Duration
+
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+func newPhaseTracer() *phaseTracer {
+	return &phaseTracer{
+		durations: make(map[Phase]time.Duration),
+	}
+}
+
+// withTrace returns a context which reports the phases of the requests it is attached to, to this tracer.
+func (tracer *phaseTracer) withTrace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			tracer.start(&tracer.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			tracer.done(PhaseDNS, &tracer.dnsStart)
+		},
+		ConnectStart: func(network, addr string) {
+			tracer.start(&tracer.connectStart)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				tracer.done(PhaseConnect, &tracer.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			tracer.start(&tracer.tlsStart)
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err == nil {
+				tracer.done(PhaseTLS, &tracer.tlsStart)
+			}
+		},
+		GotConn: func(httptrace.GotConnInfo) {
+			tracer.start(&tracer.gotConn)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			tracer.start(&tracer.wroteRequest)
+			tracer.done(PhaseSend, &tracer.gotConn)
+		},
+		GotFirstResponseByte: func() {
+			tracer.start(&tracer.firstByte)
+			tracer.done(PhaseWait, &tracer.wroteRequest)
+		},
+	})
+}
+
+func (tracer *phaseTracer) start(t *time.Time) {
+	tracer.mutex.Lock()
+	*t = time.Now()
+	tracer.mutex.Unlock()
+}
+
+func (tracer *phaseTracer) done(phase Phase, start *time.Time) {
+	tracer.mutex.Lock()
+	defer tracer.mutex.Unlock()
+	if _, ok := tracer.durations[phase]; !ok && !start.IsZero() {
+		tracer.durations[phase] = time.Since(*start)
+	}
+}
+
+// bodyRead times the transfer phase, once the whole response body was read.
+func (tracer *phaseTracer) bodyRead() {
+	tracer.done(PhaseTransfer, &tracer.firstByte)
+}
+
+// reset forgets the phases of the previous request.
+func (tracer *phaseTracer) reset() {
+	tracer.mutex.Lock()
+	defer tracer.mutex.Unlock()
+	for phase := range tracer.durations {
+		delete(tracer.durations, phase)
+	}
+	tracer.dnsStart = time.Time{}
+	tracer.connectStart = time.Time{}
+	tracer.tlsStart = time.Time{}
+	tracer.gotConn = time.Time{}
+	tracer.wroteRequest = time.Time{}
+	tracer.firstByte = time.Time{}
+}
+
+// record adds the phases of the last request to histograms.
+func (tracer *phaseTracer) record(phases map[Phase]*Histogram) {
+	tracer.mutex.Lock()
+	defer tracer.mutex.Unlock()
+	for phase, d := range tracer.durations {
+		phases[phase].Record(d)
+	}
+}
+
+// newPhaseHistograms returns one empty histogram per phase.
+func newPhaseHistograms(settings *Settings) map[Phase]*Histogram {
+	phases := make(map[Phase]*Histogram)
+	for _, phase := range Phases {
+		phases[phase], _ = newHistogram(settings)
+	}
+	return phases
+}
@@ -0,0 +1,75 @@
+package kurl_test
+
+import (
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTracePhases(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	// Resolve a host name rather than dialing an IP address, so that the DNS phase happens
+	request, err := http.NewRequest("GET", "http://localhost:"+server.URL[len("http://127.0.0.1:"):], nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 3,
+		TracePhases:  true,
+	}
+
+	result, err := kurl.Do(
+		settings,
+		*request,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	require.Equal(t, settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+
+	require.NotNil(t, result.Phases)
+	for _, phase := range kurl.Phases {
+		require.NotNil(t, result.Phases[phase], string(phase))
+	}
+
+	// Every request is sent, waited for, and its response is read
+	assert.Equal(t, result.CompletedCount, result.Phases[kurl.PhaseSend].Count())
+	assert.Equal(t, result.CompletedCount, result.Phases[kurl.PhaseWait].Count())
+	assert.Equal(t, result.CompletedCount, result.Phases[kurl.PhaseTransfer].Count())
+	assert.LessOrEqual(t, int64(20*time.Millisecond), int64(result.Phases[kurl.PhaseWait].Min()))
+
+	// Connections are opened at least once per thread, there is no TLS handshake over HTTP
+	assert.LessOrEqual(t, settings.ThreadCount, result.Phases[kurl.PhaseConnect].Count())
+	assert.Greater(t, result.CompletedCount, result.Phases[kurl.PhaseConnect].Count())
+	assert.LessOrEqual(t, settings.ThreadCount, result.Phases[kurl.PhaseDNS].Count())
+	assert.Equal(t, 0, result.Phases[kurl.PhaseTLS].Count())
+}
+
+func TestNoTracePhases(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	result, err := kurl.Do(
+		kurl.Settings{
+			ThreadCount:  1,
+			RequestCount: 1,
+		},
+		*request,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Nil(t, result.Phases)
+}
@@ -0,0 +1,95 @@
+package kurl
+
+import (
+	"time"
+)
+
+// DefaultProgressInterval is how often Settings.Progress is called when Settings.ProgressInterval is 0.
+const DefaultProgressInterval = time.Second
+
+// Progress is a snapshot of the statistics of a run still in progress.
+type Progress struct {
+	Elapsed              time.Duration // time since the run started
+	CompletedCount       int           // requests completed since the run started
+	ErrorCount           int           // requests errored since the run started
+	StatusCodesFrequency map[int]int   // status codes received since the run started
+	Rate                 float64       // completed requests per second since the previous snapshot
+	Recent               *Histogram    // latencies of the requests completed since the previous snapshot
+}
+
+// startProgress calls settings.Progress periodically until the returned function is called.
+// The returned function blocks until settings.Progress is no longer running.
+func startProgress(
+	settings *Settings,
+	start time.Time,
+	workerResults []workerResult,
+) func() {
+	if settings.Progress == nil {
+		return func() {}
+	}
+
+	interval := settings.ProgressInterval
+	if interval == 0 {
+		interval = DefaultProgressInterval
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		previousCompleted := 0
+		previousElapsed := time.Duration(0)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			recent, _ := newHistogram(settings)
+			progress := snapshot(time.Since(start), workerResults, recent)
+			progress.Rate = float64(progress.CompletedCount-previousCompleted) / (progress.Elapsed - previousElapsed).Seconds()
+			previousCompleted = progress.CompletedCount
+			previousElapsed = progress.Elapsed
+
+			settings.Progress(progress)
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+// snapshot aggregates the statistics of workers still running, and moves their recent latencies into recent.
+func snapshot(
+	elapsed time.Duration,
+	workerResults []workerResult,
+	recent *Histogram,
+) Progress {
+	progress := Progress{
+		Elapsed:              elapsed,
+		StatusCodesFrequency: make(map[int]int),
+		Recent:               recent,
+	}
+
+	for i := range workerResults {
+		result := &workerResults[i]
+		result.mutex.Lock()
+		progress.CompletedCount += result.completedCount
+		progress.ErrorCount += result.errorCount
+		for statusCode, freq := range result.statusCodesCount {
+			progress.StatusCodesFrequency[statusCode] += freq
+		}
+		recent.Merge(result.recent)
+		result.recent.Reset()
+		result.mutex.Unlock()
+	}
+
+	return progress
+}
@@ -0,0 +1,99 @@
+package kurl_test
+
+import (
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	lock := sync.Mutex{}
+	var snapshots []kurl.Progress
+
+	settings := kurl.Settings{
+		ThreadCount:      4,
+		Duration:         500 * time.Millisecond,
+		ProgressInterval: 100 * time.Millisecond,
+		Progress: func(progress kurl.Progress) {
+			lock.Lock()
+			snapshots = append(snapshots, progress)
+			lock.Unlock()
+		},
+	}
+
+	result, err := kurl.Do(
+		settings,
+		*request,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.LessOrEqual(t, 3, len(snapshots))
+	recent := 0
+	for i, progress := range snapshots {
+		if i > 0 {
+			assert.LessOrEqual(t, snapshots[i-1].CompletedCount, progress.CompletedCount)
+			assert.Less(t, int64(snapshots[i-1].Elapsed), int64(progress.Elapsed))
+		}
+		assert.Equal(t, progress.CompletedCount, progress.StatusCodesFrequency[http.StatusOK])
+		assert.Less(t, 0.0, progress.Rate)
+		require.NotNil(t, progress.Recent)
+		recent += progress.Recent.Count()
+	}
+	last := snapshots[len(snapshots)-1]
+	assert.Equal(t, last.CompletedCount, recent)
+	assert.LessOrEqual(t, last.CompletedCount, result.CompletedCount)
+}
+
+func TestProgressRate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	lock := sync.Mutex{}
+	var snapshots []kurl.Progress
+
+	settings := kurl.Settings{
+		ThreadCount:      2,
+		Duration:         300 * time.Millisecond,
+		Rate:             100,
+		ProgressInterval: 100 * time.Millisecond,
+		Progress: func(progress kurl.Progress) {
+			lock.Lock()
+			snapshots = append(snapshots, progress)
+			lock.Unlock()
+		},
+	}
+
+	result, err := kurl.Do(
+		settings,
+		*request,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.LessOrEqual(t, 2, len(snapshots))
+	assert.InDelta(t, 100, snapshots[0].Rate, 30)
+}
@@ -0,0 +1,309 @@
+package kurl
+
+import (
+	"crypto/tls"
+	"strconv"
+	"time"
+)
+
+// ReportVersion is the version of the Report schema. It is incremented when a field is removed or changes meaning,
+// adding a field does not change the version.
+const ReportVersion = 1
+
+// Report is a serializable summary of a run, for archiving results and comparing them between runs.
+// Durations are expressed in milliseconds, rates in requests per second.
+type Report struct {
+	Version          int                            `json:"version"`            // ReportVersion of the schema
+	Settings         ReportSettings                 `json:"settings"`           // how the run was configured
+	Completed        int                            `json:"completed"`          // requests which received an HTTP response
+	Errors           int                            `json:"errors"`             // requests which did not receive an HTTP response
+	ErrorsByCategory map[ErrorCategory]ErrorSummary `json:"errors_by_category"` // breakdown of errors, keyed by ErrorCategory
+	Failures         ErrorSummary                   `json:"failures"`           // completed requests whose response failed its assertions
+	Interrupted      bool                           `json:"interrupted"`        // the run was stopped before completion
+	DurationMs       float64                        `json:"duration_ms"`        // overall duration of the run
+	RateHz           float64                        `json:"rate_hz"`            // completed requests per second
+	StatusCodes      map[int]int                    `json:"status_codes"`       // frequency of each HTTP status code
+	Latency          *ReportLatency                 `json:"latency"`            // time to the last byte of completed requests, null when none completed
+	TimeToFirstByte  *ReportLatency                 `json:"time_to_first_byte"` // time to the first byte of completed requests, null when none completed
+	BytesReceived    int64                          `json:"bytes_received"`     // response body bytes of completed requests
+	BytesSent        int64                          `json:"bytes_sent"`         // request body bytes of completed requests
+	Phases           map[Phase]ReportLatency        `json:"phases,omitempty"`   // durations of the phases of completed requests, when traced
+	Protocols        map[string]int                 `json:"protocols"`          // completed requests by protocol of the response
+	ReuseRatio       float64                        `json:"reuse_ratio"`        // fraction of completed requests sent on a reused connection
+	TLS              *ReportTLS                     `json:"tls,omitempty"`      // negotiated TLS parameters, when requests completed over TLS
+	Steps            []ReportStep                   `json:"steps,omitempty"`    // statistics of each step, when running a scenario
+	Stages           []ReportStage                  `json:"stages,omitempty"`   // statistics of each stage of the load profile, if any
+	Thresholds       []ReportThreshold              `json:"thresholds,omitempty"`
+}
+
+// ReportThreshold is the evaluation of a Threshold on a reported run.
+type ReportThreshold struct {
+	Expression string  `json:"expression"`
+	Actual     float64 `json:"actual"` // in the unit of the metric: milliseconds for latencies, a fraction for rates of errors
+	Passed     bool    `json:"passed"`
+}
+
+// ReportTLS summarizes the TLS connections of a reported run.
+type ReportTLS struct {
+	Versions     map[string]int `json:"versions"`      // completed requests by TLS version, such as "TLS 1.3"
+	CipherSuites map[string]int `json:"cipher_suites"` // completed requests by cipher suite
+	Handshake    *ReportLatency `json:"handshake"`     // durations of the handshakes, null when no connection was opened
+}
+
+// ReportStep summarizes the requests of one step of a scenario.
+type ReportStep struct {
+	Name        string         `json:"name"`
+	Completed   int            `json:"completed"`
+	Errors      int            `json:"errors"`
+	Failures    int            `json:"failures"`
+	StatusCodes map[int]int    `json:"status_codes"`
+	Latency     *ReportLatency `json:"latency"` // null when none completed
+}
+
+// ReportStage summarizes the requests which completed during one stage of a load profile.
+type ReportStage struct {
+	StartMs     float64        `json:"start_ms"` // offset of the beginning of the stage from the start of the run
+	DurationMs  float64        `json:"duration_ms"`
+	From        int            `json:"from"`   // active threads at the beginning of the stage
+	Target      int            `json:"target"` // active threads at the end of the stage
+	Completed   int            `json:"completed"`
+	Errors      int            `json:"errors"`
+	RateHz      float64        `json:"rate_hz"`
+	StatusCodes map[int]int    `json:"status_codes"`
+	Latency     *ReportLatency `json:"latency"` // null when none completed
+}
+
+// ReportSettings describes how a reported run was configured.
+type ReportSettings struct {
+	Method              string  `json:"method,omitempty"`
+	URL                 string  `json:"url,omitempty"`
+	Scenario            string  `json:"scenario,omitempty"` // name of the scenario, if any
+	ThreadCount         int     `json:"thread_count"`
+	RequestCount        int     `json:"request_count"`
+	DurationMs          float64 `json:"duration_ms"`
+	Rate                float64 `json:"rate"`
+	TimeoutMs           float64 `json:"timeout_ms"`
+	WaitBetweenRequests float64 `json:"wait_between_requests_ms"`
+	Warm                bool    `json:"warm"`
+	WarmCount           int     `json:"warm_count"`
+	WarmDurationMs      float64 `json:"warm_duration_ms"`
+	HistogramPrecision  int     `json:"histogram_precision"` // significant digits of the latency histogram, 0 when every latency was stored
+	HistogramMaxMs      float64 `json:"histogram_max_ms"`    // highest latency tracked by the histogram, 0 without histogram
+	IntervalMs          float64 `json:"interval_ms"`         // width of the intervals of the time series, 0 when none was recorded
+	TracePhases         bool    `json:"trace_phases"`
+	KeepBody            bool    `json:"keep_body"`
+	DisableKeepAlives   bool    `json:"disable_keep_alives"`
+	MaxConnsPerHost     int     `json:"max_conns_per_host"`
+	MaxIdleConnsPerHost int     `json:"max_idle_conns_per_host"`
+	IdleConnTimeoutMs   float64 `json:"idle_conn_timeout_ms"`
+	Protocol            string  `json:"protocol,omitempty"`
+	SharedTransport     bool    `json:"shared_transport"`
+
+	TLS    *ReportTLSSettings    `json:"tls,omitempty"`    // TLS configuration of the transports, null with the default configuration
+	Stages []ReportStageSettings `json:"stages,omitempty"` // load profile ramping the active threads, if any
+}
+
+// ReportTLSSettings describes the TLS configuration of a reported run.
+type ReportTLSSettings struct {
+	MinVersion   string   `json:"min_version,omitempty"`   // lowest TLS version, such as "TLS 1.2", default when empty
+	MaxVersion   string   `json:"max_version,omitempty"`   // highest TLS version, default when empty
+	CipherSuites []string `json:"cipher_suites,omitempty"` // TLS 1.0-1.2 cipher suites, default when empty
+	Insecure     bool     `json:"insecure"`                // the server certificate was not verified
+	ServerName   string   `json:"server_name,omitempty"`   // name sent with SNI instead of the host of the URL
+}
+
+// ReportStageSettings is one stage of the load profile of a reported run.
+type ReportStageSettings struct {
+	DurationMs float64 `json:"duration_ms"`
+	Target     int     `json:"target"` // active threads at the end of the stage
+}
+
+// AddThresholds adds the evaluations of thresholds to the report.
+func (report *Report) AddThresholds(evaluations []ThresholdResult) {
+	for _, evaluation := range evaluations {
+		report.Thresholds = append(report.Thresholds, ReportThreshold{
+			Expression: evaluation.Expression,
+			Actual:     evaluation.Actual,
+			Passed:     evaluation.Passed,
+		})
+	}
+}
+
+// ReportLatency summarizes the latencies of a reported run.
+type ReportLatency struct {
+	Count       int                `json:"count"`
+	MinMs       float64            `json:"min_ms"`
+	MeanMs      float64            `json:"mean_ms"`
+	MaxMs       float64            `json:"max_ms"`
+	StdDevMs    float64            `json:"stddev_ms"`
+	Percentiles map[string]float64 `json:"percentiles_ms"` // keyed by percentile name, such as "p50" or "p99.9"
+}
+
+// NewReport summarizes the result of a run configured with settings,
+// including the latency percentiles given in percent, such as 99.9.
+func NewReport(settings Settings, result *Result, percents []float64) Report {
+	report := Report{
+		Version: ReportVersion,
+		Settings: ReportSettings{
+			ThreadCount:         settings.ThreadCount,
+			RequestCount:        settings.RequestCount,
+			DurationMs:          milliseconds(settings.Duration),
+			Rate:                settings.Rate,
+			TimeoutMs:           milliseconds(settings.Timeout),
+			WaitBetweenRequests: milliseconds(settings.WaitBetweenRequests),
+			Warm:                settings.Warm,
+			WarmCount:           settings.WarmCount,
+			WarmDurationMs:      milliseconds(settings.WarmDuration),
+			HistogramPrecision:  settings.HistogramPrecision,
+			IntervalMs:          milliseconds(settings.Interval),
+			TracePhases:         settings.TracePhases,
+			KeepBody:            settings.KeepBody,
+			DisableKeepAlives:   settings.DisableKeepAlives,
+			MaxConnsPerHost:     settings.MaxConnsPerHost,
+			MaxIdleConnsPerHost: settings.MaxIdleConnsPerHost,
+			IdleConnTimeoutMs:   milliseconds(settings.IdleConnTimeout),
+			Protocol:            string(settings.Protocol),
+			SharedTransport:     settings.SharedTransport,
+			TLS:                 newReportTLSSettings(settings.TLSConfig),
+		},
+		Completed:        result.CompletedCount,
+		Errors:           result.ErrorCount,
+		ErrorsByCategory: result.Errors,
+		Failures:         result.Failures,
+		Interrupted:      result.Interrupted,
+		DurationMs:       milliseconds(result.OverallDuration),
+		StatusCodes:      result.StatusCodesFrequency,
+		BytesReceived:    result.BytesReceived,
+		BytesSent:        result.BytesSent,
+		Protocols:        result.Protocols,
+		ReuseRatio:       result.ConnectionReuseRatio(),
+	}
+	if settings.HistogramPrecision > 0 {
+		report.Settings.HistogramMaxMs = milliseconds(DefaultHistogramMax)
+		if settings.HistogramMax > 0 {
+			report.Settings.HistogramMaxMs = milliseconds(settings.HistogramMax)
+		}
+	}
+	for _, stage := range settings.Stages {
+		report.Settings.Stages = append(report.Settings.Stages, ReportStageSettings{
+			DurationMs: milliseconds(stage.Duration),
+			Target:     stage.Target,
+		})
+	}
+	if result.OverallDuration > 0 {
+		report.RateHz = float64(result.CompletedCount) / result.OverallDuration.Seconds()
+	}
+
+	if result.CompletedCount > 0 {
+		latency := newReportLatency(result.CompletedCount, result.LatencyStats(), result.Percentile, percents)
+		report.Latency = &latency
+	}
+	if result.TimeToFirstByte != nil && result.TimeToFirstByte.Count() > 0 {
+		ttfb := newReportLatency(result.TimeToFirstByte.Count(), result.TimeToFirstByte.LatencyStats(), result.TimeToFirstByte.Percentile, percents)
+		report.TimeToFirstByte = &ttfb
+	}
+
+	if len(result.TLSVersions) > 0 {
+		report.TLS = &ReportTLS{
+			Versions:     result.TLSVersions,
+			CipherSuites: result.CipherSuites,
+		}
+		if handshakes := result.TLSHandshakes; handshakes != nil && handshakes.Count() > 0 {
+			latency := newReportLatency(handshakes.Count(), handshakes.LatencyStats(), handshakes.Percentile, percents)
+			report.TLS.Handshake = &latency
+		}
+	}
+
+	if result.Phases != nil {
+		report.Phases = make(map[Phase]ReportLatency)
+		for phase, histogram := range result.Phases {
+			report.Phases[phase] = newReportLatency(histogram.Count(), histogram.LatencyStats(), histogram.Percentile, percents)
+		}
+	}
+
+	for i := range result.Stages {
+		stage := &result.Stages[i]
+		reportStage := ReportStage{
+			StartMs:     milliseconds(stage.Start),
+			DurationMs:  milliseconds(stage.Duration),
+			From:        stage.From,
+			Target:      stage.Target,
+			Completed:   stage.CompletedCount,
+			Errors:      stage.ErrorCount,
+			RateHz:      float64(stage.CompletedCount) / stage.Duration.Seconds(),
+			StatusCodes: stage.StatusCodesFrequency,
+		}
+		if stage.CompletedCount > 0 {
+			latency := newReportLatency(stage.CompletedCount, stage.Histogram.LatencyStats(), stage.Histogram.Percentile, percents)
+			reportStage.Latency = &latency
+		}
+		report.Stages = append(report.Stages, reportStage)
+	}
+
+	for i := range result.Steps {
+		step := &result.Steps[i]
+		reportStep := ReportStep{
+			Name:        step.Name,
+			Completed:   step.CompletedCount,
+			Errors:      step.ErrorCount,
+			Failures:    step.Failures.Count,
+			StatusCodes: step.StatusCodesFrequency,
+		}
+		if step.CompletedCount > 0 {
+			latency := newReportLatency(step.CompletedCount, step.LatencyStats(), step.Percentile, percents)
+			reportStep.Latency = &latency
+		}
+		report.Steps = append(report.Steps, reportStep)
+	}
+	return report
+}
+
+// newReportTLSSettings describes a TLS configuration, or returns nil for the default one.
+func newReportTLSSettings(config *tls.Config) *ReportTLSSettings {
+	if config == nil {
+		return nil
+	}
+	settings := &ReportTLSSettings{
+		Insecure:   config.InsecureSkipVerify,
+		ServerName: config.ServerName,
+	}
+	if config.MinVersion != 0 {
+		settings.MinVersion = TLSVersionName(config.MinVersion)
+	}
+	if config.MaxVersion != 0 {
+		settings.MaxVersion = TLSVersionName(config.MaxVersion)
+	}
+	for _, id := range config.CipherSuites {
+		settings.CipherSuites = append(settings.CipherSuites, CipherSuiteName(id))
+	}
+	return settings
+}
+
+func newReportLatency(
+	count int,
+	stats LatencyStats,
+	percentile func(p float64) time.Duration,
+	percents []float64,
+) ReportLatency {
+	latency := ReportLatency{
+		Count:       count,
+		MinMs:       milliseconds(stats.Min),
+		MeanMs:      milliseconds(stats.Mean),
+		MaxMs:       milliseconds(stats.Max),
+		StdDevMs:    milliseconds(stats.StdDev),
+		Percentiles: make(map[string]float64),
+	}
+	for _, percent := range percents {
+		latency.Percentiles[PercentileName(percent)] = milliseconds(percentile(percent / 100))
+	}
+	return latency
+}
+
+// PercentileName returns the name of a percentile given in percent, for instance "p99.9" for 99.9.
+func PercentileName(percent float64) string {
+	return "p" + strconv.FormatFloat(percent, 'f', -1, 64)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,124 @@
+package kurl_test
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 2,
+		Timeout:      time.Second,
+	}
+	result := kurl.Result{
+		CompletedCount:       3,
+		ErrorCount:           1,
+		OverallDuration:      2 * time.Second,
+		Latencies:            []time.Duration{10 * time.Millisecond, 0, 20 * time.Millisecond, 30 * time.Millisecond},
+		StatusCodesFrequency: map[int]int{200: 2, 503: 1},
+	}
+
+	report := kurl.NewReport(settings, &result, []float64{50, 99.9})
+	report.Settings.Method = "GET"
+	report.Settings.URL = "http://localhost"
+
+	data, err := json.Marshal(report)
+	require.Nil(t, err)
+
+	var decoded map[string]interface{}
+	require.Nil(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, float64(kurl.ReportVersion), decoded["version"])
+	assert.Equal(t, float64(3), decoded["completed"])
+	assert.Equal(t, float64(1), decoded["errors"])
+	assert.Equal(t, false, decoded["interrupted"])
+	assert.Equal(t, float64(2000), decoded["duration_ms"])
+	assert.Equal(t, 1.5, decoded["rate_hz"])
+	assert.Equal(t, map[string]interface{}{"200": float64(2), "503": float64(1)}, decoded["status_codes"])
+
+	decodedSettings := decoded["settings"].(map[string]interface{})
+	assert.Equal(t, "GET", decodedSettings["method"])
+	assert.Equal(t, "http://localhost", decodedSettings["url"])
+	assert.Equal(t, float64(2), decodedSettings["thread_count"])
+	assert.Equal(t, float64(1000), decodedSettings["timeout_ms"])
+
+	latency := decoded["latency"].(map[string]interface{})
+	assert.Equal(t, float64(10), latency["min_ms"])
+	assert.Equal(t, float64(20), latency["mean_ms"])
+	assert.Equal(t, float64(30), latency["max_ms"])
+	assert.Equal(t, float64(10), latency["stddev_ms"])
+	assert.Equal(t, map[string]interface{}{"p50": float64(20), "p99.9": float64(30)}, latency["percentiles_ms"])
+
+	// A report can be read back
+	var readBack kurl.Report
+	require.Nil(t, json.Unmarshal(data, &readBack))
+	assert.Equal(t, report, readBack)
+}
+
+func TestReportSettings(t *testing.T) {
+	settings := kurl.Settings{
+		ThreadCount:        4,
+		HistogramPrecision: 3,
+		Interval:           time.Second,
+		TracePhases:        true,
+		KeepBody:           true,
+		TLSConfig: &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			MaxVersion:         tls.VersionTLS13,
+			CipherSuites:       []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+			InsecureSkipVerify: true,
+			ServerName:         "example.com",
+		},
+		Stages: []kurl.Stage{
+			{Duration: time.Minute, Target: 4},
+			{Duration: 30 * time.Second, Target: 0},
+		},
+	}
+	report := kurl.NewReport(settings, &kurl.Result{}, []float64{50})
+	assert.Equal(t, 3, report.Settings.HistogramPrecision)
+	assert.Equal(t, float64(kurl.DefaultHistogramMax/time.Millisecond), report.Settings.HistogramMaxMs)
+	assert.Equal(t, 1000.0, report.Settings.IntervalMs)
+	assert.True(t, report.Settings.TracePhases)
+	assert.True(t, report.Settings.KeepBody)
+	assert.Equal(t, &kurl.ReportTLSSettings{
+		MinVersion:   "TLS 1.2",
+		MaxVersion:   "TLS 1.3",
+		CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+		Insecure:     true,
+		ServerName:   "example.com",
+	}, report.Settings.TLS)
+	assert.Equal(t, []kurl.ReportStageSettings{
+		{DurationMs: 60000, Target: 4},
+		{DurationMs: 30000, Target: 0},
+	}, report.Settings.Stages)
+
+	data, err := json.Marshal(report)
+	require.Nil(t, err)
+	var readBack kurl.Report
+	require.Nil(t, json.Unmarshal(data, &readBack))
+	assert.Equal(t, report, readBack)
+
+	// The default TLS configuration and a constant load are not reported
+	report = kurl.NewReport(kurl.Settings{ThreadCount: 4}, &kurl.Result{}, []float64{50})
+	assert.Nil(t, report.Settings.TLS)
+	assert.Nil(t, report.Settings.Stages)
+	assert.Equal(t, 0.0, report.Settings.HistogramMaxMs)
+}
+
+func TestReportNothingCompleted(t *testing.T) {
+	result := kurl.Result{ErrorCount: 1, StatusCodesFrequency: map[int]int{}}
+
+	report := kurl.NewReport(kurl.Settings{}, &result, []float64{50})
+	assert.Nil(t, report.Latency)
+	assert.Equal(t, 0.0, report.RateHz)
+}
+
+func TestPercentileName(t *testing.T) {
+	assert.Equal(t, "p50", kurl.PercentileName(50))
+	assert.Equal(t, "p99.9", kurl.PercentileName(99.9))
+}
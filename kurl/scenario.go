@@ -0,0 +1,312 @@
+package kurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"net/http"
+	"time"
+)
+
+// Step is one request of a Scenario.
+type Step struct {
+	Name      string            `yaml:"name"`       // identifies the step in Result.Steps, "METHOD URL" when empty
+	Method    string            `yaml:"method"`     // GET when empty
+	URL       string            `yaml:"url"`        // absolute URL
+	Headers   map[string]string `yaml:"headers"`    // header values, keyed by header name
+	Body      string            `yaml:"body"`       // request body, none when empty
+	ThinkTime time.Duration     `yaml:"think_time"` // pause after the step, such as "1s", like a user reading the response
+	Extract   []Extraction      `yaml:"extract"`    // values saved from the responses of the step, for the following steps
+	Assert    *Assertions       `yaml:"assert"`     // what the responses of the step must satisfy, nothing when nil
+}
+
+// Scenario is a flow of requests, such as login, list, get and update, which every thread sends in order.
+// Each thread repeats the whole scenario Settings.RequestCount times, or for Settings.Duration.
+//
+// The URL, header values and body of a step are text/template templates, rendered before every request
+// with the variables of the thread, such as {{.token}}. Each thread starts with its own copy of Variables,
+// sets the fields of a row of the Feeder before every run of the scenario, and sets the values extracted
+// from responses.
+type Scenario struct {
+	Name      string            `yaml:"name"`
+	Variables map[string]string `yaml:"variables"` // initial variables of every thread
+	Steps     []Step            `yaml:"steps"`
+	Feeder    *Feeder           `yaml:"-"` // rows of data for the templates, none when nil
+}
+
+// StepResult holds the statistics of the requests of one step of a scenario.
+type StepResult struct {
+	Name string
+	Result
+}
+
+// ParseScenario reads a scenario from YAML, such as:
+//
+//	name: browse
+//	steps:
+//	  - name: login
+//	    method: POST
+//	    url: https://domain/login
+//	    headers:
+//	      Content-Type: application/json
+//	    body: '{"user": "kurl"}'
+//	    think_time: 1s
+//	    extract:
+//	      - name: token
+//	        json: data.token
+//	  - name: list
+//	    url: https://domain/items
+//	    headers:
+//	      Authorization: Bearer {{.token}}
+//	    assert:
+//	      status: [200]
+//	      json:
+//	        data.count: "3"
+func ParseScenario(data []byte) (*Scenario, error) {
+	var scenario Scenario
+	if err := yaml.UnmarshalStrict(data, &scenario); err != nil {
+		return nil, errors.New("Invalid scenario: " + err.Error())
+	}
+	return &scenario, nil
+}
+
+// StepName returns the name of a step in Result.Steps.
+func (step *Step) StepName() string {
+	if step.Name != "" {
+		return step.Name
+	}
+	return step.method() + " " + step.URL
+}
+
+func (step *Step) method() string {
+	if step.Method == "" {
+		return "GET"
+	}
+	return step.Method
+}
+
+// Request returns the HTTP request of a step, with its templates left as they are.
+func (step *Step) Request() (*http.Request, error) {
+	return newStepRequest(context.Background(), step.method(), step.URL, step.Headers, step.Body)
+}
+
+func newStepRequest(
+	ctx context.Context,
+	method string,
+	url string,
+	headers map[string]string,
+	body string,
+) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if request.URL.Scheme == "" || request.URL.Host == "" {
+		return nil, errors.New("The URL must be absolute")
+	}
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	if body != "" {
+		SetBody(request, []byte(body))
+	}
+	return request, nil
+}
+
+// DoScenario runs a scenario on every thread. Result.Steps holds the statistics of each step, while the other
+// fields of the Result cover the requests of all steps. With a non-zero Settings.Rate, each scheduled send
+// starts one run of the scenario.
+func DoScenario(
+	settings Settings,
+	scenario Scenario,
+) (*Result, error) {
+	return DoScenarioContext(context.Background(), settings, scenario)
+}
+
+// DoScenarioContext is like DoScenario, but stops all threads and aborts in-flight requests when ctx is done.
+func DoScenarioContext(
+	ctx context.Context,
+	settings Settings,
+	scenario Scenario,
+) (*Result, error) {
+	if len(scenario.Steps) == 0 {
+		return nil, errors.New("The scenario must have at least one step")
+	}
+	if err := validateSettings(&settings); err != nil {
+		return nil, err
+	}
+
+	// Each step has either a fixed request, or a template rendered before every request
+	steps := make([]*compiledStep, len(scenario.Steps))
+	thinkTimes := make([]time.Duration, len(scenario.Steps))
+	for i := range scenario.Steps {
+		var err error
+		if steps[i], err = compileStep(&settings, &scenario.Steps[i]); err != nil {
+			return nil, err
+		}
+		thinkTimes[i] = scenario.Steps[i].ThinkTime
+	}
+
+	clients, err := newClients(&settings, settings.ThreadCount)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each worker has one result per step, grouped by step so that each step can be aggregated on its own
+	timeSeries := newTimeSeries(&settings)
+	stages := newStageSeries(&settings)
+	workerResults := make([]workerResult, len(scenario.Steps)*settings.ThreadCount)
+	flows := make([]*flow, settings.ThreadCount)
+	var feeds []*feed
+	if scenario.Feeder != nil {
+		if feeds, err = scenario.Feeder.forThreads(settings.ThreadCount, scenario.Variables); err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; i < settings.ThreadCount; i++ {
+		vars := make(map[string]string)
+		for key, value := range scenario.Variables {
+			vars[key] = value
+		}
+		flows[i] = &flow{thinkTimes: thinkTimes, vars: vars}
+		if feeds != nil {
+			flows[i].feed = feeds[i]
+		}
+		for j, step := range steps {
+			result := &workerResults[j*settings.ThreadCount+i]
+			result.init(&settings, timeSeries, stages)
+			flows[i].senders = append(flows[i].senders, step.newSender(ctx, &settings, clients[i], result, vars))
+		}
+	}
+
+	result, err := run(ctx, settings, flows, workerResults, timeSeries, stages)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Steps = make([]StepResult, len(scenario.Steps))
+	for j := range scenario.Steps {
+		stepResults := workerResults[j*settings.ThreadCount : (j+1)*settings.ThreadCount]
+		result.Steps[j] = StepResult{
+			Name:   scenario.Steps[j].StepName(),
+			Result: aggregateResults(settings, result.OverallDuration, stepResults),
+		}
+		result.Steps[j].Interrupted = result.Interrupted
+	}
+	return result, nil
+}
+
+// DoManySteps issues a set of concurrent HTTP requests like DoMany, where each thread repeats its own step.
+// The URL, header values and body of a step are templates, rendered before every request with the variables
+// of its thread, such as {{.token}}. Each thread starts with its own copy of variables[i], or with no variable
+// when variables is nil, and sets the values its step extracts from every response, such as the cursor
+// of the next page. The assertions of a step test its responses, as a Test would.
+func DoManySteps(
+	settings Settings,
+	steps []Step, // length of this array must be equal to settings.ThreadCount
+	variables []map[string]string, // length of this array must be equal to settings.ThreadCount, unless nil
+) (*Result, error) {
+	return DoManyStepsContext(context.Background(), settings, steps, variables)
+}
+
+// DoManyStepsContext is like DoManySteps, but stops all threads and aborts in-flight requests when ctx is done.
+func DoManyStepsContext(
+	ctx context.Context,
+	settings Settings,
+	steps []Step, // length of this array must be equal to settings.ThreadCount
+	variables []map[string]string, // length of this array must be equal to settings.ThreadCount, unless nil
+) (*Result, error) {
+	if settings.ThreadCount != len(steps) {
+		return nil, errors.New("The length of steps must be equal to settings.ThreadCount")
+	}
+	if variables != nil && settings.ThreadCount != len(variables) {
+		return nil, errors.New("The length of variables must be equal to settings.ThreadCount")
+	}
+	if err := validateSettings(&settings); err != nil {
+		return nil, err
+	}
+
+	compiled := make([]*compiledStep, settings.ThreadCount)
+	for i := range steps {
+		var err error
+		if compiled[i], err = compileStep(&settings, &steps[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Prepare one sender per thread, each with its own client and its own variables
+	timeSeries := newTimeSeries(&settings)
+	stages := newStageSeries(&settings)
+	workerResults := make([]workerResult, settings.ThreadCount)
+	flows := make([]*flow, settings.ThreadCount)
+	clients, err := newClients(&settings, settings.ThreadCount)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < settings.ThreadCount; i++ {
+		vars := make(map[string]string)
+		if variables != nil {
+			for key, value := range variables[i] {
+				vars[key] = value
+			}
+		}
+		workerResults[i].init(&settings, timeSeries, stages)
+		flows[i] = &flow{
+			senders:    []*sender{compiled[i].newSender(ctx, &settings, clients[i], &workerResults[i], vars)},
+			thinkTimes: []time.Duration{steps[i].ThinkTime},
+			vars:       vars,
+		}
+	}
+
+	return run(ctx, settings, flows, workerResults, timeSeries, stages)
+}
+
+// compiledStep is a step ready to send: a fixed request, or a template rendered before every request.
+type compiledStep struct {
+	step        *Step
+	request     *http.Request    // nil when the step has a template
+	template    *requestTemplate // nil when the step has none
+	extractions []*extraction
+}
+
+// compileStep parses the templates and extractions of a step, or builds its fixed request.
+func compileStep(settings *Settings, step *Step) (*compiledStep, error) {
+	compiled := &compiledStep{step: step}
+	err := validateScheme(settings, step.URL)
+	if err == nil {
+		compiled.template, err = newRequestTemplate(step)
+	}
+	if err == nil && compiled.template == nil {
+		compiled.request, err = step.Request()
+	}
+	for i := 0; err == nil && i < len(step.Extract); i++ {
+		var e *extraction
+		e, err = compileExtraction(step.Extract[i])
+		compiled.extractions = append(compiled.extractions, e)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid step %s: %v", step.StepName(), err)
+	}
+	return compiled, nil
+}
+
+// newSender returns a sender of the step for a worker whose variables are vars.
+func (c *compiledStep) newSender(
+	ctx context.Context,
+	settings *Settings,
+	client *http.Client,
+	result *workerResult,
+	vars map[string]string,
+) *sender {
+	var test Test
+	if c.step.Assert != nil {
+		test = c.step.Assert.Test()
+	}
+	sender := newSender(ctx, settings, client, c.request, test, result)
+	sender.keepBody = sender.keepBody || (c.step.Assert != nil && c.step.Assert.ReadsBody())
+	sender.template = c.template
+	sender.extractions = c.extractions
+	sender.vars = vars
+	return sender
+}
@@ -0,0 +1,164 @@
+package kurl_test
+
+import (
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseScenario(t *testing.T) {
+	scenario, err := kurl.ParseScenario([]byte(`
+name: browse
+steps:
+  - name: login
+    method: POST
+    url: http://localhost/login
+    headers:
+      Content-Type: application/json
+    body: '{"user": "kurl"}'
+    think_time: 100ms
+  - url: http://localhost/items
+`))
+	require.Nil(t, err)
+	require.NotNil(t, scenario)
+	assert.Equal(t, "browse", scenario.Name)
+	require.Len(t, scenario.Steps, 2)
+	assert.Equal(t, "login", scenario.Steps[0].StepName())
+	assert.Equal(t, "POST", scenario.Steps[0].Method)
+	assert.Equal(t, "application/json", scenario.Steps[0].Headers["Content-Type"])
+	assert.Equal(t, `{"user": "kurl"}`, scenario.Steps[0].Body)
+	assert.Equal(t, 100*time.Millisecond, scenario.Steps[0].ThinkTime)
+	assert.Equal(t, "GET http://localhost/items", scenario.Steps[1].StepName())
+
+	_, err = kurl.ParseScenario([]byte(`steps: [{url: http://localhost, thinktime: 1s}]`))
+	assert.NotNil(t, err)
+}
+
+func newScenarioServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/login":
+			body, err := ioutil.ReadAll(req.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, "POST", req.Method)
+			assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+			assert.Equal(t, `{"user": "kurl"}`, string(body))
+			rw.Write([]byte(`OK`))
+		case "/items":
+			assert.Equal(t, "GET", req.Method)
+			rw.Write([]byte(`[]`))
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestDoScenario(t *testing.T) {
+	server := newScenarioServer(t)
+	defer server.Close()
+
+	scenario := kurl.Scenario{
+		Steps: []kurl.Step{
+			{Name: "login", Method: "POST", URL: server.URL + "/login", Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"user": "kurl"}`},
+			{Name: "list", URL: server.URL + "/items"},
+			{Name: "missing", URL: server.URL + "/missing"},
+		},
+	}
+	settings := kurl.Settings{
+		ThreadCount:  4,
+		RequestCount: 5,
+		Warm:         true,
+	}
+
+	result, err := kurl.DoScenario(settings, scenario)
+	require.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 0, result.ErrorCount)
+	assert.Equal(t, 3*settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+	require.Len(t, result.Steps, 3)
+
+	assert.Equal(t, "login", result.Steps[0].Name)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.Steps[0].StatusCodesFrequency[http.StatusOK])
+	assert.Equal(t, int64(settings.ThreadCount*settings.RequestCount*len(`{"user": "kurl"}`)), result.Steps[0].BytesSent)
+	assert.Equal(t, "list", result.Steps[1].Name)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.Steps[1].StatusCodesFrequency[http.StatusOK])
+	assert.Len(t, result.Steps[1].Latencies, settings.ThreadCount*settings.RequestCount)
+	assert.Less(t, int64(0), int64(result.Steps[1].Percentile(0.5)))
+	assert.Equal(t, "missing", result.Steps[2].Name)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.Steps[2].StatusCodesFrequency[http.StatusNotFound])
+
+	report := kurl.NewReport(settings, result, []float64{50})
+	require.Len(t, report.Steps, 3)
+	assert.Equal(t, "list", report.Steps[1].Name)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, report.Steps[1].Completed)
+	require.NotNil(t, report.Steps[1].Latency)
+	assert.Contains(t, report.Steps[1].Latency.Percentiles, "p50")
+}
+
+func TestDoScenarioThinkTime(t *testing.T) {
+	server := newScenarioServer(t)
+	defer server.Close()
+
+	scenario := kurl.Scenario{
+		Steps: []kurl.Step{
+			{URL: server.URL + "/items", ThinkTime: 50 * time.Millisecond},
+			{URL: server.URL + "/items"},
+		},
+	}
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 2,
+	}
+
+	result, err := kurl.DoScenario(settings, scenario)
+	require.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 2*settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+	assert.LessOrEqual(t, int64(2*scenario.Steps[0].ThinkTime), int64(result.OverallDuration))
+
+	// Think time is not part of the latencies
+	assert.Greater(t, int64(scenario.Steps[0].ThinkTime), int64(result.Steps[0].LatencyStats().Max))
+}
+
+func TestDoScenarioRate(t *testing.T) {
+	server := newScenarioServer(t)
+	defer server.Close()
+
+	scenario := kurl.Scenario{
+		Steps: []kurl.Step{
+			{URL: server.URL + "/items"},
+			{URL: server.URL + "/missing"},
+		},
+	}
+	settings := kurl.Settings{
+		ThreadCount:  4,
+		RequestCount: 5,
+		Rate:         200,
+	}
+
+	result, err := kurl.DoScenario(settings, scenario)
+	require.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 2*settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.Steps[0].CompletedCount)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.Steps[1].CompletedCount)
+}
+
+func TestDoScenarioInvalid(t *testing.T) {
+	settings := kurl.Settings{
+		ThreadCount:  1,
+		RequestCount: 1,
+	}
+
+	_, err := kurl.DoScenario(settings, kurl.Scenario{})
+	assert.NotNil(t, err)
+
+	_, err = kurl.DoScenario(settings, kurl.Scenario{Steps: []kurl.Step{{Name: "relative", URL: "/items"}}})
+	require.NotNil(t, err)
+	assert.Equal(t, "Invalid step relative: The URL must be absolute", err.Error())
+}
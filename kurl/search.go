@@ -0,0 +1,277 @@
+package kurl
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// SearchLoad is the load a Search increases from one run to the next.
+type SearchLoad string
+
+// The loads of SearchSettings.Load.
+const (
+	SearchThreads SearchLoad = "threads" // the number of threads of the closed model, Settings.ThreadCount
+	SearchRate    SearchLoad = "rate"    // the arrival rate of the open model, Settings.Rate, with Settings.ThreadCount capping concurrency
+)
+
+// SearchMode is how a Search chooses the load of its next run.
+type SearchMode string
+
+// The modes of SearchSettings.Mode.
+const (
+	SearchLinear SearchMode = "linear" // increase the load by a fixed step until a threshold fails
+	SearchBinary SearchMode = "binary" // bisect the load between the highest run which passed and the lowest run which failed
+)
+
+// SearchSettings configure a Search for the highest load meeting thresholds.
+type SearchSettings struct {
+	Load       SearchLoad       // the load to increase, SearchThreads when empty
+	Mode       SearchMode       // how to increase the load, SearchLinear when empty
+	Start      float64          // load of the first run
+	Max        float64          // highest load to run
+	Step       float64          // increase of the load between runs of a linear search, whose last run is at Max
+	Precision  float64          // a binary search stops when the passing and failing loads are this close, 1 when 0
+	Thresholds []Threshold      // conditions each run must meet to sustain its load
+	Pause      time.Duration    // how long to wait between runs, to let the service recover
+	Progress   func(SearchStep) // called after each run, if set
+}
+
+// RunFunc runs a load test with settings, such as DoContext with a request, or DoScenarioContext with a scenario.
+type RunFunc func(ctx context.Context, settings Settings) (*Result, error)
+
+// SearchStep is one run of a Search.
+type SearchStep struct {
+	Load       float64
+	Result     *Result
+	Thresholds []ThresholdResult
+	Passed     bool // every threshold passed, and the run was not interrupted
+}
+
+// SearchResult holds the runs of a Search, in the order they ran.
+type SearchResult struct {
+	Steps       []SearchStep
+	ReachedMax  bool // the run of the highest load passed, so the knee may be beyond SearchSettings.Max
+	Interrupted bool // the context was done before the search completed
+}
+
+// Knee returns the run of the highest load which passed, or nil if none passed.
+func (result *SearchResult) Knee() *SearchStep {
+	var knee *SearchStep
+	for i := range result.Steps {
+		step := &result.Steps[i]
+		if step.Passed && (knee == nil || step.Load > knee.Load) {
+			knee = step
+		}
+	}
+	return knee
+}
+
+// SortedSteps returns the runs of the search by increasing load.
+func (result *SearchResult) SortedSteps() []SearchStep {
+	steps := append([]SearchStep(nil), result.Steps...)
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].Load < steps[j].Load
+	})
+	return steps
+}
+
+// Search runs load tests of increasing load, as settings with the load of each run, until one fails
+// a threshold, to find the knee: the highest load the service sustains within its service level objectives.
+func Search(ctx context.Context, settings Settings, search SearchSettings, run RunFunc) (*SearchResult, error) {
+	if search.Load == "" {
+		search.Load = SearchThreads
+	}
+	if search.Mode == "" {
+		search.Mode = SearchLinear
+	}
+	if search.Precision == 0 {
+		search.Precision = 1
+	}
+	if err := validateSearch(&settings, &search); err != nil {
+		return nil, err
+	}
+
+	searchResult := &SearchResult{}
+
+	// try runs the load and returns whether it passed, and whether the search can go on
+	try := func(load float64) (bool, bool, error) {
+		if len(searchResult.Steps) > 0 && search.Pause > 0 {
+			sleep(ctx, search.Pause)
+		}
+		if ctx.Err() != nil {
+			searchResult.Interrupted = true
+			return false, false, nil
+		}
+
+		result, err := run(ctx, search.settings(settings, load))
+		if err != nil {
+			return false, false, err
+		}
+
+		evaluations, passed := EvaluateThresholds(search.Thresholds, result)
+		step := SearchStep{
+			Load:       load,
+			Result:     result,
+			Thresholds: evaluations,
+			Passed:     passed && !result.Interrupted,
+		}
+		searchResult.Steps = append(searchResult.Steps, step)
+		if search.Progress != nil {
+			search.Progress(step)
+		}
+		if result.Interrupted {
+			searchResult.Interrupted = true
+			return false, false, nil
+		}
+		return step.Passed, true, nil
+	}
+
+	if search.Mode == SearchLinear {
+		// The last run is at the highest load, even when it is less than a step above the previous run
+		for i := 0; ; i++ {
+			load := math.Min(search.Start+float64(i)*search.Step, search.Max)
+			if i > 0 && load <= search.Start+float64(i-1)*search.Step {
+				searchResult.ReachedMax = true
+				return searchResult, nil
+			}
+			passed, ok, err := try(load)
+			if err != nil || !ok || !passed {
+				return searchResult, err
+			}
+		}
+	}
+
+	passed, ok, err := try(search.Start)
+	if err != nil || !ok || !passed {
+		return searchResult, err
+	}
+	if search.Max == search.Start {
+		searchResult.ReachedMax = true
+		return searchResult, nil
+	}
+	passed, ok, err = try(search.Max)
+	if err != nil || !ok {
+		return searchResult, err
+	}
+	if passed {
+		searchResult.ReachedMax = true
+		return searchResult, nil
+	}
+
+	low, high := search.Start, search.Max
+	for high-low > search.Precision {
+		load := (low + high) / 2
+		if search.Load == SearchThreads {
+			load = math.Floor(load)
+		}
+		passed, ok, err := try(load)
+		if err != nil || !ok {
+			return searchResult, err
+		}
+		if passed {
+			low = load
+		} else {
+			high = load
+		}
+	}
+	return searchResult, nil
+}
+
+// settings returns the settings of a run of the search at load.
+func (search *SearchSettings) settings(settings Settings, load float64) Settings {
+	if search.Load == SearchRate {
+		settings.Rate = load
+	} else {
+		settings.ThreadCount = int(load)
+	}
+	return settings
+}
+
+// validateSearch returns an error if the search settings are invalid.
+func validateSearch(settings *Settings, search *SearchSettings) error {
+	switch search.Load {
+	case SearchThreads:
+		if search.Start != math.Trunc(search.Start) || search.Max != math.Trunc(search.Max) ||
+			search.Step != math.Trunc(search.Step) || search.Precision != math.Trunc(search.Precision) {
+			return errors.New("A search of threads must start, end and step at whole numbers of threads")
+		}
+		if settings.Rate > 0 {
+			return errors.New("A search of threads cannot be used with settings.Rate")
+		}
+	case SearchRate:
+	default:
+		return errors.New("search.Load must be threads or rate")
+	}
+	switch search.Mode {
+	case SearchLinear:
+		if search.Step <= 0 {
+			return errors.New("search.Step must be positive for a linear search")
+		}
+	case SearchBinary:
+	default:
+		return errors.New("search.Mode must be linear or binary")
+	}
+	if search.Start <= 0 {
+		return errors.New("search.Start must be positive")
+	}
+	if search.Max < search.Start {
+		return errors.New("search.Max cannot be lower than search.Start")
+	}
+	if search.Precision < 0 {
+		return errors.New("search.Precision cannot be negative")
+	}
+	if len(search.Thresholds) == 0 {
+		return errors.New("A search requires at least one threshold")
+	}
+	if settings.Stages != nil {
+		return errors.New("settings.Stages cannot be used with a search")
+	}
+	return nil
+}
+
+// SearchReport is a serializable summary of a Search, with the Report of each run.
+type SearchReport struct {
+	Load        SearchLoad         `json:"load"`
+	Knee        *float64           `json:"knee"`        // highest load which passed, null if none passed
+	ReachedMax  bool               `json:"reached_max"` // the highest load passed, the knee may be beyond it
+	Interrupted bool               `json:"interrupted"` // the search was stopped before completion
+	Steps       []SearchReportStep `json:"steps"`       // by increasing load
+}
+
+// SearchReportStep summarizes one run of a Search.
+type SearchReportStep struct {
+	Load   float64 `json:"load"`
+	Passed bool    `json:"passed"`
+	Report Report  `json:"report"`
+}
+
+// NewSearchReport summarizes a search run with settings, with the given latency percentiles, such as 99 for p99.
+func NewSearchReport(settings Settings, search SearchSettings, result *SearchResult, percents []float64) SearchReport {
+	report := SearchReport{
+		Load:        search.Load,
+		ReachedMax:  result.ReachedMax,
+		Interrupted: result.Interrupted,
+		Steps:       []SearchReportStep{},
+	}
+	if report.Load == "" {
+		report.Load = SearchThreads
+	}
+	if knee := result.Knee(); knee != nil {
+		load := knee.Load
+		report.Knee = &load
+	}
+
+	for _, step := range result.SortedSteps() {
+		stepReport := NewReport(search.settings(settings, step.Load), step.Result, percents)
+		stepReport.AddThresholds(step.Thresholds)
+		report.Steps = append(report.Steps, SearchReportStep{
+			Load:   step.Load,
+			Passed: step.Passed,
+			Report: stepReport,
+		})
+	}
+	return report
+}
@@ -0,0 +1,207 @@
+package kurl_test
+
+import (
+	"context"
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newSaturatingServer returns a server which slows down when it serves more than capacity requests at once.
+func newSaturatingServer(capacity int) *httptest.Server {
+	var lock sync.Mutex
+	active := 0
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		active++
+		saturated := active > capacity
+		lock.Unlock()
+
+		if saturated {
+			time.Sleep(50 * time.Millisecond)
+		} else {
+			time.Sleep(time.Millisecond)
+		}
+
+		lock.Lock()
+		active--
+		lock.Unlock()
+	}))
+}
+
+func TestSearchThreads(t *testing.T) {
+	server := newSaturatingServer(3)
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+	run := func(ctx context.Context, settings kurl.Settings) (*kurl.Result, error) {
+		return kurl.DoContext(ctx, settings, *request)
+	}
+
+	threshold, err := kurl.ParseThreshold("max<30ms")
+	require.Nil(t, err)
+	settings := kurl.Settings{RequestCount: 10}
+
+	// A linear search stops at the first load which fails
+	var progress []float64
+	search := kurl.SearchSettings{
+		Start:      1,
+		Step:       1,
+		Max:        10,
+		Thresholds: []kurl.Threshold{threshold},
+		Progress: func(step kurl.SearchStep) {
+			progress = append(progress, step.Load)
+		},
+	}
+	result, err := kurl.Search(context.Background(), settings, search, run)
+	require.Nil(t, err)
+	assert.Equal(t, []float64{1, 2, 3, 4}, progress)
+	require.Len(t, result.Steps, 4)
+	assert.False(t, result.Steps[3].Passed)
+	assert.False(t, result.Steps[3].Thresholds[0].Passed)
+	assert.Equal(t, 4*settings.RequestCount, result.Steps[3].Result.CompletedCount)
+	assert.False(t, result.ReachedMax)
+	require.NotNil(t, result.Knee())
+	assert.Equal(t, 3.0, result.Knee().Load)
+
+	// A binary search bisects between the start and the max
+	search.Mode = kurl.SearchBinary
+	search.Progress = nil
+	result, err = kurl.Search(context.Background(), settings, search, run)
+	require.Nil(t, err)
+	loads := make([]float64, len(result.Steps))
+	for i, step := range result.Steps {
+		loads[i] = step.Load
+	}
+	assert.Equal(t, []float64{1, 10, 5, 3, 4}, loads)
+	require.NotNil(t, result.Knee())
+	assert.Equal(t, 3.0, result.Knee().Load)
+
+	report := kurl.NewSearchReport(settings, search, result, []float64{99})
+	assert.Equal(t, kurl.SearchThreads, report.Load)
+	require.NotNil(t, report.Knee)
+	assert.Equal(t, 3.0, *report.Knee)
+	require.Len(t, report.Steps, 5)
+	for i, step := range report.Steps {
+		assert.Equal(t, []float64{1, 3, 4, 5, 10}[i], step.Load)
+		assert.Equal(t, int(step.Load), step.Report.Settings.ThreadCount)
+		assert.Equal(t, step.Load <= 3, step.Passed)
+		require.Len(t, step.Report.Thresholds, 1)
+	}
+
+	// The service sustains the highest load
+	search.Max = 3
+	result, err = kurl.Search(context.Background(), settings, search, run)
+	require.Nil(t, err)
+	assert.True(t, result.ReachedMax)
+	assert.Equal(t, 3.0, result.Knee().Load)
+}
+
+func TestSearchRate(t *testing.T) {
+	threshold, err := kurl.ParseThreshold("error_rate<1%")
+	require.Nil(t, err)
+
+	// The service fails the requests beyond 375Hz
+	run := func(ctx context.Context, settings kurl.Settings) (*kurl.Result, error) {
+		result := &kurl.Result{CompletedCount: int(settings.Rate), OverallDuration: time.Second}
+		if settings.Rate > 375 {
+			result.CompletedCount = 375
+			result.ErrorCount = int(settings.Rate) - 375
+		}
+		return result, nil
+	}
+
+	settings := kurl.Settings{ThreadCount: 10, Duration: time.Second}
+	search := kurl.SearchSettings{
+		Load:       kurl.SearchRate,
+		Mode:       kurl.SearchBinary,
+		Start:      100,
+		Max:        1000,
+		Precision:  10,
+		Thresholds: []kurl.Threshold{threshold},
+	}
+	result, err := kurl.Search(context.Background(), settings, search, run)
+	require.Nil(t, err)
+	knee := result.Knee()
+	require.NotNil(t, knee)
+	assert.LessOrEqual(t, knee.Load, 375.0)
+	assert.Less(t, 375.0-10, knee.Load)
+	assert.False(t, result.ReachedMax)
+
+	// A linear search runs the highest load, even off the steps
+	search.Mode = kurl.SearchLinear
+	search.Start = 100
+	search.Step = 30
+	search.Max = 170
+	result, err = kurl.Search(context.Background(), settings, search, run)
+	require.Nil(t, err)
+	loads := make([]float64, len(result.Steps))
+	for i, step := range result.Steps {
+		loads[i] = step.Load
+	}
+	assert.Equal(t, []float64{100, 130, 160, 170}, loads)
+	assert.True(t, result.ReachedMax)
+
+	// The start already fails
+	search.Mode = kurl.SearchBinary
+	search.Max = 1000
+	search.Start = 400
+	result, err = kurl.Search(context.Background(), settings, search, run)
+	require.Nil(t, err)
+	assert.Len(t, result.Steps, 1)
+	assert.Nil(t, result.Knee())
+}
+
+func TestSearchInterrupted(t *testing.T) {
+	threshold, err := kurl.ParseThreshold("error_rate<1%")
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run := func(ctx context.Context, settings kurl.Settings) (*kurl.Result, error) {
+		if settings.ThreadCount == 2 {
+			cancel()
+		}
+		return &kurl.Result{CompletedCount: 1, Interrupted: ctx.Err() != nil}, nil
+	}
+
+	search := kurl.SearchSettings{Start: 1, Step: 1, Max: 5, Thresholds: []kurl.Threshold{threshold}}
+	result, err := kurl.Search(ctx, kurl.Settings{RequestCount: 1}, search, run)
+	require.Nil(t, err)
+	assert.True(t, result.Interrupted)
+	require.Len(t, result.Steps, 2)
+	assert.False(t, result.Steps[1].Passed)
+	assert.Equal(t, 1.0, result.Knee().Load)
+}
+
+func TestInvalidSearch(t *testing.T) {
+	threshold, err := kurl.ParseThreshold("p99<100ms")
+	require.Nil(t, err)
+	run := func(ctx context.Context, settings kurl.Settings) (*kurl.Result, error) {
+		t.Fatal("An invalid search must not run")
+		return nil, nil
+	}
+
+	valid := kurl.SearchSettings{Start: 1, Step: 1, Max: 5, Thresholds: []kurl.Threshold{threshold}}
+	for _, invalid := range []func(*kurl.Settings, *kurl.SearchSettings){
+		func(settings *kurl.Settings, search *kurl.SearchSettings) { search.Load = "requests" },
+		func(settings *kurl.Settings, search *kurl.SearchSettings) { search.Mode = "random" },
+		func(settings *kurl.Settings, search *kurl.SearchSettings) { search.Start = 0 },
+		func(settings *kurl.Settings, search *kurl.SearchSettings) { search.Max = 0.5 },
+		func(settings *kurl.Settings, search *kurl.SearchSettings) { search.Step = 0 },
+		func(settings *kurl.Settings, search *kurl.SearchSettings) { search.Step = 1.5 },
+		func(settings *kurl.Settings, search *kurl.SearchSettings) { search.Thresholds = nil },
+		func(settings *kurl.Settings, search *kurl.SearchSettings) { settings.Rate = 100 },
+	} {
+		settings := kurl.Settings{RequestCount: 1}
+		search := valid
+		invalid(&settings, &search)
+		_, err := kurl.Search(context.Background(), settings, search, run)
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,122 @@
+package kurl
+
+import "math"
+
+// welchTest returns the two-sided p-value of Welch's t-test that two samples,
+// given by their mean, standard deviation and size, have the same mean.
+func welchTest(mean1, stddev1 float64, n1 int, mean2, stddev2 float64, n2 int) float64 {
+	if n1 < 2 || n2 < 2 {
+		return 1
+	}
+	v1 := stddev1 * stddev1 / float64(n1)
+	v2 := stddev2 * stddev2 / float64(n2)
+	if v1+v2 == 0 {
+		if mean1 == mean2 {
+			return 1
+		}
+		return 0
+	}
+
+	t := (mean2 - mean1) / math.Sqrt(v1+v2)
+	df := (v1 + v2) * (v1 + v2) / (v1*v1/float64(n1-1) + v2*v2/float64(n2-1))
+	return regularizedIncompleteBeta(df/(df+t*t), df/2, 0.5)
+}
+
+// proportionTest returns the two-sided p-value of the two-proportion z-test that
+// x1 successes out of n1 and x2 out of n2 have the same probability.
+func proportionTest(x1, n1, x2, n2 int) float64 {
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+	p := float64(x1+x2) / float64(n1+n2)
+	se := math.Sqrt(p * (1 - p) * (1/float64(n1) + 1/float64(n2)))
+	if se == 0 {
+		return 1
+	}
+	z := (float64(x2)/float64(n2) - float64(x1)/float64(n1)) / se
+	return math.Erfc(math.Abs(z) / math.Sqrt2)
+}
+
+// poissonRateTest returns the two-sided p-value of the z-test that count1 events in duration1 and count2
+// events in duration2, in seconds, occur at the same rate, approximating each count as a Poisson variable.
+func poissonRateTest(count1 int, duration1 float64, count2 int, duration2 float64) float64 {
+	if duration1 <= 0 || duration2 <= 0 {
+		return 1
+	}
+	se := math.Sqrt(float64(count1)/(duration1*duration1) + float64(count2)/(duration2*duration2))
+	if se == 0 {
+		return 1
+	}
+	z := (float64(count2)/duration2 - float64(count1)/duration1) / se
+	return math.Erfc(math.Abs(z) / math.Sqrt2)
+}
+
+// regularizedIncompleteBeta returns I_x(a, b), evaluated with the continued fraction of Numerical Recipes.
+func regularizedIncompleteBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	lgab, _ := math.Lgamma(a + b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+
+	// The continued fraction converges quickly only below (a+1)/(a+b+2), use the symmetry I_x(a,b) = 1-I_1-x(b,a) above
+	if x > (a+1)/(a+b+2) {
+		return 1 - front*betaContinuedFraction(1-x, b, a)/b
+	}
+	return front * betaContinuedFraction(x, a, b) / a
+}
+
+func betaContinuedFraction(x, a, b float64) float64 {
+	const (
+		maxIterations = 300
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+
+		// Even step
+		numerator := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+
+		// Odd step
+		numerator = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
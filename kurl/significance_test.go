@@ -0,0 +1,108 @@
+package kurl
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+// The reference values are exact binomial sums for I_x(a, b) with integer a and b, the closed forms of
+// Student's t distribution with 2 and 4 degrees of freedom, numerical integrals of its density otherwise,
+// and the z-tests as computed by statsmodels' proportions_ztest and scipy.stats.norm.sf.
+
+func TestRegularizedIncompleteBeta(t *testing.T) {
+	for _, test := range []struct {
+		x, a, b  float64
+		expected float64
+	}{
+		{0, 2, 3, 0},
+		{1, 2, 3, 1},
+		{0.3, 1, 1, 0.3},
+		{0.3, 2, 3, 0.3483},
+		{0.7, 5, 2, 0.420175},
+		{0.5, 10, 10, 0.5},
+		{0.1, 1, 4, 0.3439},
+		{0.9, 30, 1, 0.0423911582752162},
+		{0.99, 50, 60, 1},
+		{0.2, 200, 3, 2.0930368026473348e-136},
+		{0.25, 0.5, 0.5, 1.0 / 3}, // arcsine distribution: 2/pi asin(sqrt(x))
+	} {
+		actual := regularizedIncompleteBeta(test.x, test.a, test.b)
+		if test.expected == 0 {
+			assert.Equal(t, 0.0, actual)
+		} else {
+			assert.InEpsilon(t, test.expected, actual, 1e-9, "I_%v(%v, %v)", test.x, test.a, test.b)
+		}
+	}
+}
+
+func TestWelchTest(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		mean1, stddev1 float64
+		n1             int
+		mean2, stddev2 float64
+		n2             int
+		expected       float64
+	}{
+		// Two samples of 2 with the same variance have 2 degrees of freedom: p = 1 - t/sqrt(2+t^2)
+		{"df 2, t 1", 0, 1, 2, 1, 1, 2, 0.42264973081037416},
+		{"df 2, t 3", 10, 1, 2, 13, 1, 2, 0.09546596626670911},
+		// Two samples of 3 with the same variance have 4 degrees of freedom: p = 1 - t(6+t^2)/(4+t^2)^1.5
+		{"df 4, t 1", 0, 1, 3, math.Sqrt(2.0 / 3), 1, 3, 0.37390096630005887},
+		{"df 4, t -2.5", 5, 2, 3, 5 - 2.5*2*math.Sqrt(2.0/3), 2, 3, 0.06676654481198807},
+		// Unequal variances have 10.9756 degrees of freedom by the Welch-Satterthwaite equation
+		{"unequal variances", 0, 1, 10, 1, 3, 10, 0.33884730781546135},
+		// Large samples are close to the normal distribution, whose p-value would be 0.04999579
+		{"large samples", 100, 1, 1000000, 100 + 1.96*math.Sqrt(2e-6), 1, 1000000, 0.04999592886217197},
+		{"same sample", 100, 20, 50, 100, 20, 50, 1},
+		{"n1 < 2", 100, 0, 1, 200, 10, 50, 1},
+		{"n2 < 2", 100, 10, 50, 200, 0, 1, 1},
+		{"empty", 0, 0, 0, 0, 0, 0, 1},
+		{"zero variance, same means", 100, 0, 10, 100, 0, 10, 1},
+		{"zero variance, different means", 100, 0, 10, 101, 0, 10, 0},
+	} {
+		actual := welchTest(test.mean1, test.stddev1, test.n1, test.mean2, test.stddev2, test.n2)
+		assert.InDelta(t, test.expected, actual, 1e-9, test.name)
+		reversed := welchTest(test.mean2, test.stddev2, test.n2, test.mean1, test.stddev1, test.n1)
+		assert.InDelta(t, actual, reversed, 1e-12, test.name)
+	}
+}
+
+func TestProportionTest(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		x1, n1, x2, n2 int
+		expected       float64
+	}{
+		{"10% vs 20%", 10, 100, 20, 100, 0.04767038065616144},
+		{"0.5% vs 4.8%", 5, 1005, 40, 840, 3.351656415676671e-09},
+		{"same proportion", 10, 100, 100, 1000, 1},
+		{"zero counts", 0, 100, 0, 200, 1},
+		{"all successes", 100, 100, 200, 200, 1},
+		{"empty baseline", 0, 0, 5, 100, 1},
+		{"empty current", 5, 100, 0, 0, 1},
+	} {
+		assert.InEpsilon(t, test.expected, proportionTest(test.x1, test.n1, test.x2, test.n2), 1e-9, test.name)
+		assert.InEpsilon(t, test.expected, proportionTest(test.x2, test.n2, test.x1, test.n1), 1e-9, test.name)
+	}
+}
+
+func TestPoissonRateTest(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		count1    int
+		duration1 float64
+		count2    int
+		duration2 float64
+		expected  float64
+	}{
+		{"100Hz vs 80Hz", 1000, 10, 800, 10, 2.428467472975848e-06},
+		{"10Hz vs 11Hz", 100, 10, 110, 10, 0.49015296041582507},
+		{"same rate", 100, 10, 200, 20, 1},
+		{"zero counts", 0, 10, 0, 10, 1},
+		{"zero duration", 100, 0, 100, 10, 1},
+	} {
+		assert.InEpsilon(t, test.expected, poissonRateTest(test.count1, test.duration1, test.count2, test.duration2), 1e-9, test.name)
+	}
+}
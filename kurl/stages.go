@@ -0,0 +1,238 @@
+package kurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stage is one stage of a load profile: the number of active threads ramps linearly to Target over Duration,
+// from the Target of the previous stage, or from 0 for the first stage. A stage with the same Target as the
+// previous one holds the load.
+type Stage struct {
+	Duration time.Duration
+	Target   int // number of active threads at the end of the stage
+}
+
+// StageResult holds the statistics of the requests which completed during one stage of a run.
+type StageResult struct {
+	Stage
+	From                 int           // number of active threads at the beginning of the stage
+	Start                time.Duration // offset of the beginning of the stage from the start of the run
+	CompletedCount       int
+	ErrorCount           int
+	StatusCodesFrequency map[int]int
+	Histogram            *Histogram // latencies of the requests completed during the stage
+}
+
+// ParseStages parses a load profile of comma-separated stages, each a duration and a target number of threads,
+// such as "1m:200,5m:200,30s:0" to ramp up to 200 threads over a minute, hold for 5 minutes, then ramp down.
+func ParseStages(profile string) ([]Stage, error) {
+	var stages []Stage
+	for _, str := range strings.Split(profile, ",") {
+		arr := strings.Split(strings.TrimSpace(str), ":")
+		if len(arr) != 2 {
+			return nil, errors.New("Invalid stage " + str + ", expected a duration and a thread count such as 1m:200")
+		}
+		duration, err := time.ParseDuration(arr[0])
+		if err != nil {
+			return nil, errors.New("Invalid stage " + str + ", bad duration " + arr[0])
+		}
+		target, err := strconv.Atoi(arr[1])
+		if err != nil {
+			return nil, errors.New("Invalid stage " + str + ", bad thread count " + arr[1])
+		}
+		stages = append(stages, Stage{Duration: duration, Target: target})
+	}
+	return stages, nil
+}
+
+// MaxTarget returns the highest number of active threads of a load profile.
+func MaxTarget(stages []Stage) int {
+	max := 0
+	for _, stage := range stages {
+		if stage.Target > max {
+			max = stage.Target
+		}
+	}
+	return max
+}
+
+// validateStages returns an error if the stages of settings do not describe a valid load profile.
+func validateStages(settings *Settings) error {
+	if settings.Stages == nil {
+		return nil
+	}
+	if settings.Rate > 0 {
+		return errors.New("settings.Stages cannot be used with settings.Rate")
+	}
+	for i, stage := range settings.Stages {
+		if stage.Duration <= 0 {
+			return fmt.Errorf("The duration of stage %d must be positive", i+1)
+		}
+		if stage.Target < 0 || stage.Target > settings.ThreadCount {
+			return fmt.Errorf("The target of stage %d must be between 0 and settings.ThreadCount", i+1)
+		}
+	}
+	return nil
+}
+
+// loadProfile tells the workers of a staged run when to send requests.
+type loadProfile struct {
+	stages []Stage
+	start  time.Time // set before workers are released
+}
+
+func newLoadProfile(settings *Settings) *loadProfile {
+	if settings.Stages == nil {
+		return nil
+	}
+	return &loadProfile{stages: settings.Stages}
+}
+
+// duration returns the total duration of the stages.
+func (profile *loadProfile) duration() time.Duration {
+	var total time.Duration
+	for _, stage := range profile.stages {
+		total += stage.Duration
+	}
+	return total
+}
+
+// level returns the number of active threads at offset from the start, possibly fractional during a ramp.
+func (profile *loadProfile) level(offset time.Duration) float64 {
+	from := 0.0
+	for _, stage := range profile.stages {
+		to := float64(stage.Target)
+		if offset < stage.Duration {
+			return from + (to-from)*float64(offset)/float64(stage.Duration)
+		}
+		offset -= stage.Duration
+		from = to
+	}
+	return from
+}
+
+// nextActive returns the first offset from the start, no earlier than offset, at which thread i is active,
+// that is when more than i threads are active. It returns false if thread i is never active again.
+func (profile *loadProfile) nextActive(i int, offset time.Duration) (time.Duration, bool) {
+	threshold := float64(i)
+	stageStart := time.Duration(0)
+	from := 0.0
+	for _, stage := range profile.stages {
+		stageEnd := stageStart + stage.Duration
+		to := float64(stage.Target)
+		if offset < stageEnd {
+			t := offset
+			if t < stageStart {
+				t = stageStart
+			}
+			if profile.level(t) > threshold {
+				return t, true
+			}
+			if to > threshold {
+				// The ramp up crosses the threshold during this stage
+				crossing := stageStart + time.Duration((threshold-from)/(to-from)*float64(stage.Duration)) + 1
+				if crossing < t {
+					crossing = t
+				}
+				return crossing, true
+			}
+		}
+		stageStart = stageEnd
+		from = to
+	}
+	return 0, false
+}
+
+// run runs the flow of thread i whenever the profile has it active, until the last stage ends or ctx is done.
+func (profile *loadProfile) run(ctx context.Context, settings *Settings, flow *flow, i int) {
+	end := profile.duration()
+	for ctx.Err() == nil {
+		offset := time.Since(profile.start)
+		if offset >= end {
+			return
+		}
+		if profile.level(offset) <= float64(i) {
+			next, ok := profile.nextActive(i, offset)
+			if !ok || next >= end {
+				return
+			}
+			sleep(ctx, next-offset)
+			continue
+		}
+
+		start := time.Now()
+		flow.run(ctx, start)
+
+		// Delay this thread if we need to wait between requests
+		elapsedSinceLastRequest := time.Since(start)
+		if elapsedSinceLastRequest < settings.WaitBetweenRequests {
+			sleep(ctx, settings.WaitBetweenRequests-elapsedSinceLastRequest)
+		}
+	}
+}
+
+// stageSeries records the outcome of requests in the stage during which they completed. It is shared by all workers.
+type stageSeries struct {
+	mutex  sync.Mutex
+	start  time.Time // set before workers are released
+	stages []StageResult
+}
+
+func newStageSeries(settings *Settings) *stageSeries {
+	if settings.Stages == nil {
+		return nil
+	}
+	series := &stageSeries{}
+	from := 0
+	var start time.Duration
+	for _, stage := range settings.Stages {
+		histogram, _ := newHistogram(settings)
+		series.stages = append(series.stages, StageResult{
+			Stage:                stage,
+			From:                 from,
+			Start:                start,
+			StatusCodesFrequency: make(map[int]int),
+			Histogram:            histogram,
+		})
+		from = stage.Target
+		start += stage.Duration
+	}
+	return series
+}
+
+// record adds the outcome of a request which completed at end.
+// Requests which complete after the last stage ended are added to the last stage.
+func (series *stageSeries) record(end time.Time, latency time.Duration, statusCode int, err error) {
+	series.mutex.Lock()
+	defer series.mutex.Unlock()
+
+	offset := end.Sub(series.start)
+	i := len(series.stages) - 1
+	for i > 0 && offset < series.stages[i].Start {
+		i--
+	}
+	stage := &series.stages[i]
+	if err != nil {
+		stage.ErrorCount++
+		return
+	}
+	stage.CompletedCount++
+	stage.StatusCodesFrequency[statusCode]++
+	stage.Histogram.Record(latency)
+}
+
+// result returns the statistics of each stage.
+func (series *stageSeries) result() []StageResult {
+	if series == nil {
+		return nil
+	}
+	series.mutex.Lock()
+	defer series.mutex.Unlock()
+	return series.stages
+}
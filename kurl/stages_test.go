@@ -0,0 +1,120 @@
+package kurl_test
+
+import (
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseStages(t *testing.T) {
+	stages, err := kurl.ParseStages("1m:200, 5m:200,30s:0")
+	require.Nil(t, err)
+	assert.Equal(t, []kurl.Stage{
+		{Duration: time.Minute, Target: 200},
+		{Duration: 5 * time.Minute, Target: 200},
+		{Duration: 30 * time.Second, Target: 0},
+	}, stages)
+	assert.Equal(t, 200, kurl.MaxTarget(stages))
+
+	for _, profile := range []string{"", "1m", "1m:200:3", "forever:200", "1m:many"} {
+		_, err := kurl.ParseStages(profile)
+		assert.NotNil(t, err, profile)
+	}
+}
+
+func TestStages(t *testing.T) {
+	var lock sync.Mutex
+	active := 0
+	maxActive := 0
+	var connections []time.Time
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		lock.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		lock.Lock()
+		active--
+		lock.Unlock()
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			lock.Lock()
+			connections = append(connections, time.Now())
+			lock.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount: 4,
+		Stages: []kurl.Stage{
+			{Duration: 200 * time.Millisecond, Target: 4},
+			{Duration: 200 * time.Millisecond, Target: 4},
+			{Duration: 200 * time.Millisecond, Target: 0},
+		},
+	}
+	result, err := kurl.Do(settings, *request)
+	require.Nil(t, err)
+	require.NotNil(t, result)
+	assert.LessOrEqual(t, int64(600*time.Millisecond), int64(result.OverallDuration))
+	assert.Greater(t, int64(800*time.Millisecond), int64(result.OverallDuration))
+	assert.Equal(t, 0, result.ErrorCount)
+	assert.Equal(t, settings.ThreadCount, maxActive)
+
+	// Threads start one after the other during the ramp up, each opening its connection
+	require.Len(t, connections, settings.ThreadCount)
+	assert.Less(t, int64(100*time.Millisecond), int64(connections[len(connections)-1].Sub(connections[0])))
+
+	require.Len(t, result.Stages, 3)
+	total := 0
+	for i, stage := range result.Stages {
+		assert.Equal(t, settings.Stages[i], stage.Stage)
+		assert.Equal(t, time.Duration(i)*200*time.Millisecond, stage.Start)
+		assert.Equal(t, stage.CompletedCount, stage.Histogram.Count())
+		total += stage.CompletedCount
+	}
+	assert.Equal(t, result.CompletedCount, total)
+	assert.Equal(t, 0, result.Stages[0].From)
+	assert.Equal(t, 4, result.Stages[1].From)
+	assert.Equal(t, 4, result.Stages[2].From)
+
+	// Holding 4 threads sends about twice as many requests as ramping between 0 and 4
+	assert.Greater(t, result.Stages[1].CompletedCount, result.Stages[0].CompletedCount)
+	assert.Greater(t, result.Stages[1].CompletedCount, result.Stages[2].CompletedCount)
+
+	report := kurl.NewReport(settings, result, []float64{50})
+	require.Len(t, report.Stages, 3)
+	assert.Equal(t, 200.0, report.Stages[1].StartMs)
+	assert.Equal(t, result.Stages[1].CompletedCount, report.Stages[1].Completed)
+	require.NotNil(t, report.Stages[1].Latency)
+}
+
+func TestInvalidStages(t *testing.T) {
+	request, err := http.NewRequest("GET", "http://localhost", nil)
+	require.Nil(t, err)
+
+	for _, settings := range []kurl.Settings{
+		{ThreadCount: 2, Stages: []kurl.Stage{{Duration: time.Second, Target: 3}}},
+		{ThreadCount: 2, Stages: []kurl.Stage{{Duration: time.Second, Target: -1}}},
+		{ThreadCount: 2, Stages: []kurl.Stage{{Duration: 0, Target: 2}}},
+		{ThreadCount: 2, Stages: []kurl.Stage{{Duration: time.Second, Target: 2}}, Rate: 10},
+	} {
+		_, err := kurl.Do(settings, *request)
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,241 @@
+package kurl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Extraction saves a value from the response of a step into a variable of the worker,
+// which the templates of the following requests of that worker use as {{.name}}.
+// Exactly one of JSON, Header and Regex must be set. When the value is not found the variable is removed,
+// so that the templates which use it fail rather than send a stale value.
+type Extraction struct {
+	Name   string `yaml:"name"`   // name of the variable
+	JSON   string `yaml:"json"`   // dot-separated path into a JSON body, such as "data.items.0.id"
+	Header string `yaml:"header"` // name of a response header
+	Regex  string `yaml:"regex"`  // regular expression matched against the body, extracting its first group, or the whole match without group
+}
+
+// extraction is a compiled Extraction.
+type extraction struct {
+	Extraction
+	regex *regexp.Regexp
+}
+
+func compileExtraction(e Extraction) (*extraction, error) {
+	if e.Name == "" {
+		return nil, errors.New("An extraction must have a name")
+	}
+	set := 0
+	for _, source := range []string{e.JSON, e.Header, e.Regex} {
+		if source != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.New("Extraction " + e.Name + " must have one of json, header or regex")
+	}
+
+	compiled := &extraction{Extraction: e}
+	if e.Regex != "" {
+		regex, err := regexp.Compile(e.Regex)
+		if err != nil {
+			return nil, errors.New("Extraction " + e.Name + ": " + err.Error())
+		}
+		compiled.regex = regex
+	}
+	return compiled, nil
+}
+
+// fromBody returns whether the extraction needs the response body.
+func (e *extraction) fromBody() bool {
+	return e.Header == ""
+}
+
+// extract returns the value of the extraction in a response with the given body.
+func (e *extraction) extract(resp *http.Response, body []byte) (string, bool) {
+	switch {
+	case e.Header != "":
+		values, ok := resp.Header[http.CanonicalHeaderKey(e.Header)]
+		if !ok || len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	case e.regex != nil:
+		match := e.regex.FindSubmatch(body)
+		if match == nil {
+			return "", false
+		}
+		if len(match) > 1 {
+			return string(match[1]), true
+		}
+		return string(match[0]), true
+	default:
+		return jsonPath(body, e.JSON)
+	}
+}
+
+// jsonPath returns the value at a dot-separated path into a JSON document, where array elements are
+// designated by their index. Strings are returned unquoted, objects and arrays as JSON.
+func jsonPath(body []byte, path string) (string, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", false
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			child, ok := node[key]
+			if !ok {
+				return "", false
+			}
+			value = child
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", false
+			}
+			value = node[i]
+		default:
+			return "", false
+		}
+	}
+
+	return jsonString(value)
+}
+
+// jsonString returns a decoded JSON value as a string: strings unquoted, and objects and arrays as JSON.
+// There is no string for null.
+func jsonString(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case json.Number:
+		return value.String(), true
+	case bool:
+		return strconv.FormatBool(value), true
+	case nil:
+		return "", false
+	default:
+		encoded, err := json.Marshal(value)
+		return string(encoded), err == nil
+	}
+}
+
+// extractAll saves the values of the extractions of a sender into the worker's variables.
+func (s *sender) extractAll(resp *http.Response) {
+	var body []byte
+	for _, e := range s.extractions {
+		if e.fromBody() {
+			body, _ = ioutil.ReadAll(resp.Body)
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+			break
+		}
+	}
+
+	for _, e := range s.extractions {
+		if value, ok := e.extract(resp, body); ok {
+			s.vars[e.Name] = value
+		} else {
+			delete(s.vars, e.Name)
+		}
+	}
+}
+
+// extractsFromBody returns whether the sender needs the response bodies for its extractions.
+func (s *sender) extractsFromBody() bool {
+	for _, e := range s.extractions {
+		if e.fromBody() {
+			return true
+		}
+	}
+	return false
+}
+
+// requestTemplate renders the URL, headers and body of the requests of a step from the variables of a worker.
+type requestTemplate struct {
+	method  string
+	url     *template.Template
+	headers map[string]*template.Template
+	body    *template.Template // nil when the step has no body
+}
+
+// isTemplate returns whether s contains template actions.
+func isTemplate(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+// newRequestTemplate parses the templates of a step, or returns nil if the step has none.
+func newRequestTemplate(step *Step) (*requestTemplate, error) {
+	templated := isTemplate(step.URL) || isTemplate(step.Body)
+	for _, value := range step.Headers {
+		templated = templated || isTemplate(value)
+	}
+	if !templated {
+		return nil, nil
+	}
+
+	t := &requestTemplate{
+		method:  step.method(),
+		headers: make(map[string]*template.Template),
+	}
+	var err error
+	if t.url, err = parseTemplate("url", step.URL); err != nil {
+		return nil, err
+	}
+	for key, value := range step.Headers {
+		if t.headers[key], err = parseTemplate(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if step.Body != "" {
+		if t.body, err = parseTemplate("body", step.Body); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func parseTemplate(name string, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(text)
+}
+
+// render returns a request bound to ctx, built from the templates and the variables of a worker.
+func (t *requestTemplate) render(ctx context.Context, vars map[string]string) (*http.Request, error) {
+	url, err := execute(t.url, vars)
+	if err != nil {
+		return nil, err
+	}
+	headers := make(map[string]string)
+	for key, value := range t.headers {
+		if headers[key], err = execute(value, vars); err != nil {
+			return nil, err
+		}
+	}
+	var body string
+	if t.body != nil {
+		if body, err = execute(t.body, vars); err != nil {
+			return nil, err
+		}
+	}
+	return newStepRequest(ctx, t.method, url, headers, body)
+}
+
+func execute(t *template.Template, vars map[string]string) (string, error) {
+	var rendered strings.Builder
+	if err := t.Execute(&rendered, vars); err != nil {
+		return "", err
+	}
+	return rendered.String(), nil
+}
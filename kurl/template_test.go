@@ -0,0 +1,212 @@
+package kurl_test
+
+import (
+	"fmt"
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newLoginServer issues a new token on every login, and only accepts the requests which present a valid token.
+func newLoginServer(t *testing.T) *httptest.Server {
+	lock := sync.Mutex{}
+	tokens := make(map[string]bool)
+
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		switch {
+		case req.URL.Path == "/login":
+			body, err := ioutil.ReadAll(req.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, `{"user": "kurl"}`, string(body))
+
+			token := fmt.Sprintf("token%d", len(tokens))
+			tokens[token] = true
+			rw.Header().Set("X-Session", "session-"+token)
+			fmt.Fprintf(rw, `{"data": {"token": "%s", "items": [{"id": 7}, {"id": 8}]}}`, token)
+		case strings.HasPrefix(req.URL.Path, "/items/"):
+			token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+			if !tokens[token] || req.Header.Get("X-Session") != "session-"+token {
+				rw.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(rw, `<item id="%s" owner="%s"/>`, strings.TrimPrefix(req.URL.Path, "/items/"), token)
+		case req.URL.Path == "/owner":
+			body, err := ioutil.ReadAll(req.Body)
+			assert.Nil(t, err)
+			assert.True(t, tokens[string(body)], string(body))
+			rw.Write([]byte(`OK`))
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestExtractAndTemplate(t *testing.T) {
+	server := newLoginServer(t)
+	defer server.Close()
+
+	scenario, err := kurl.ParseScenario([]byte(`
+variables:
+  base: ` + server.URL + `
+  user: kurl
+steps:
+  - name: login
+    method: POST
+    url: '{{.base}}/login'
+    body: '{"user": "{{.user}}"}'
+    extract:
+      - name: token
+        json: data.token
+      - name: item
+        json: data.items.1.id
+      - name: session
+        header: x-session
+  - name: item
+    url: '{{.base}}/items/{{.item}}'
+    headers:
+      Authorization: 'Bearer {{.token}}'
+      X-Session: '{{.session}}'
+    extract:
+      - name: owner
+        regex: 'owner="(\w+)"'
+  - name: owner
+    method: PUT
+    url: '{{.base}}/owner'
+    body: '{{.owner}}'
+`))
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  4,
+		RequestCount: 5,
+		Warm:         true,
+	}
+
+	result, err := kurl.DoScenario(settings, *scenario)
+	require.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 0, result.ErrorCount)
+	require.Len(t, result.Steps, 3)
+	for _, step := range result.Steps {
+		assert.Equal(t, settings.ThreadCount*settings.RequestCount, step.StatusCodesFrequency[http.StatusOK], step.Name)
+	}
+}
+
+func TestTemplateMissingVariable(t *testing.T) {
+	server := newLoginServer(t)
+	defer server.Close()
+
+	scenario := kurl.Scenario{
+		Steps: []kurl.Step{
+			{
+				Name: "login", Method: "POST", URL: server.URL + "/login", Body: `{"user": "kurl"}`,
+				Extract: []kurl.Extraction{{Name: "token", JSON: "data.missing"}},
+			},
+			{Name: "item", URL: server.URL + "/items/7", Headers: map[string]string{"Authorization": "Bearer {{.token}}"}},
+		},
+	}
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 3,
+	}
+
+	result, err := kurl.DoScenario(settings, scenario)
+	require.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.Steps[0].CompletedCount)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.Steps[1].ErrorCount)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.Steps[1].Errors[kurl.ErrorOther].Count)
+	assert.Contains(t, result.Steps[1].Errors[kurl.ErrorOther].Samples[0], "token")
+}
+
+func TestInvalidExtraction(t *testing.T) {
+	settings := kurl.Settings{
+		ThreadCount:  1,
+		RequestCount: 1,
+	}
+
+	for _, extraction := range []kurl.Extraction{
+		{JSON: "token"},
+		{Name: "token"},
+		{Name: "token", JSON: "token", Header: "token"},
+		{Name: "token", Regex: "("},
+	} {
+		scenario := kurl.Scenario{
+			Steps: []kurl.Step{{URL: "http://localhost", Extract: []kurl.Extraction{extraction}}},
+		}
+		_, err := kurl.DoScenario(settings, scenario)
+		assert.NotNil(t, err, extraction)
+	}
+
+	scenario := kurl.Scenario{
+		Steps: []kurl.Step{{URL: "http://localhost/{{.id"}},
+	}
+	_, err := kurl.DoScenario(settings, scenario)
+	assert.NotNil(t, err)
+}
+
+func TestDoManySteps(t *testing.T) {
+	// Every page links to the next one, for the user who requested it
+	lock := sync.Mutex{}
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		page, err := strconv.Atoi(strings.TrimPrefix(req.URL.Path, "/pages/"))
+		assert.Nil(t, err)
+
+		lock.Lock()
+		received = append(received, req.Header.Get("X-User")+req.URL.Path)
+		lock.Unlock()
+		fmt.Fprintf(rw, `{"next": %d}`, page+1)
+	}))
+	defer server.Close()
+
+	step := kurl.Step{
+		URL:     server.URL + "/pages/{{.page}}",
+		Headers: map[string]string{"X-User": "{{.user}}"},
+		Extract: []kurl.Extraction{{Name: "page", JSON: "next"}},
+		Assert:  &kurl.Assertions{Status: []int{http.StatusOK}},
+	}
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 3,
+	}
+	variables := []map[string]string{
+		{"user": "a", "page": "0"},
+		{"user": "b", "page": "100"},
+	}
+
+	result, err := kurl.DoManySteps(settings, []kurl.Step{step, step}, variables)
+	require.Nil(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+	assert.Equal(t, 0, result.Failures.Count)
+	assert.ElementsMatch(t, []string{
+		"a/pages/0", "a/pages/1", "a/pages/2",
+		"b/pages/100", "b/pages/101", "b/pages/102",
+	}, received)
+
+	// The variables of a thread are its own, and not changed by the run
+	assert.Equal(t, "0", variables[0]["page"])
+
+	// Without variables, the templates fail
+	result, err = kurl.DoManySteps(settings, []kurl.Step{step, step}, nil)
+	require.Nil(t, err)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.ErrorCount)
+
+	_, err = kurl.DoManySteps(settings, []kurl.Step{step}, nil)
+	assert.NotNil(t, err)
+	_, err = kurl.DoManySteps(settings, []kurl.Step{step, step}, variables[:1])
+	assert.NotNil(t, err)
+	_, err = kurl.DoManySteps(settings, []kurl.Step{step, {URL: server.URL + "/{{.page"}}, variables)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,207 @@
+package kurl
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Threshold is a condition on a statistic of a run, such as "p99<300ms", "error_rate<1%" or "rate>500",
+// for failing a run which does not meet a service level objective.
+//
+// The statistics are the latency percentiles such as p50 or p99.9, the min, mean, max and stddev latencies,
+// all in milliseconds, the error_rate and failure_rate, which are fractions, the rate of completed requests
+// per second, and the completed, errors and failures counts. Latencies can be given as durations such as
+// 300ms or 1.5s, and fractions as percentages such as 1%.
+type Threshold struct {
+	Expression string
+	Metric     string  // the statistic, such as p99 or error_rate
+	Operator   string  // one of <, <=, > and >=
+	Value      float64 // in the unit of the metric
+}
+
+// ThresholdResult is the evaluation of a Threshold on the Result of a run.
+type ThresholdResult struct {
+	Threshold
+	Actual float64 // value of the metric, in the unit of the metric
+	Passed bool
+}
+
+var thresholdRegexp = regexp.MustCompile(`^\s*([a-z_]+[0-9.]*)\s*(<=|>=|<|>)\s*(\S+)\s*$`)
+
+// ParseThreshold parses a threshold expression, such as "p99<300ms".
+func ParseThreshold(expression string) (Threshold, error) {
+	match := thresholdRegexp.FindStringSubmatch(expression)
+	if match == nil {
+		return Threshold{}, errors.New("Invalid threshold " + expression + ", expected a metric, an operator and a value such as p99<300ms")
+	}
+	threshold := Threshold{
+		Expression: expression,
+		Metric:     match[1],
+		Operator:   match[2],
+	}
+	if threshold.Metric == "avg" {
+		threshold.Metric = "mean"
+	}
+
+	var err error
+	switch {
+	case threshold.isLatency():
+		threshold.Value, err = parseMilliseconds(match[3])
+	case threshold.isFraction():
+		threshold.Value, err = parseFraction(match[3])
+	case threshold.Metric == "rate":
+		threshold.Value, err = strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(match[3]), "hz"), 64)
+	case threshold.Metric == "completed" || threshold.Metric == "errors" || threshold.Metric == "failures":
+		threshold.Value, err = strconv.ParseFloat(match[3], 64)
+	default:
+		return Threshold{}, errors.New("Invalid threshold " + expression + ", unknown metric " + threshold.Metric)
+	}
+	if err != nil {
+		return Threshold{}, errors.New("Invalid threshold " + expression + ", bad value " + match[3])
+	}
+	return threshold, nil
+}
+
+func (threshold *Threshold) isLatency() bool {
+	return isLatencyMetric(threshold.Metric)
+}
+
+func (threshold *Threshold) isFraction() bool {
+	return isFractionMetric(threshold.Metric)
+}
+
+// percent returns the percentile of a percentile metric, such as 99.9 for p99.9.
+func (threshold *Threshold) percent() (float64, bool) {
+	return metricPercent(threshold.Metric)
+}
+
+func isLatencyMetric(metric string) bool {
+	switch metric {
+	case "min", "mean", "max", "stddev":
+		return true
+	}
+	_, ok := metricPercent(metric)
+	return ok
+}
+
+func isFractionMetric(metric string) bool {
+	return metric == "error_rate" || metric == "failure_rate"
+}
+
+func metricPercent(metric string) (float64, bool) {
+	if !strings.HasPrefix(metric, "p") {
+		return 0, false
+	}
+	percent, err := strconv.ParseFloat(metric[1:], 64)
+	return percent, err == nil && percent >= 0 && percent <= 100
+}
+
+// parseMilliseconds parses a duration, or a number of milliseconds.
+func parseMilliseconds(value string) (float64, error) {
+	if ms, err := strconv.ParseFloat(value, 64); err == nil {
+		return ms, nil
+	}
+	d, err := time.ParseDuration(value)
+	return milliseconds(d), err
+}
+
+// parseFraction parses a percentage such as 1%, or a fraction such as 0.01.
+func parseFraction(value string) (float64, error) {
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		return percent / 100, err
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// Evaluate returns whether the result of a run meets the threshold.
+// Latency thresholds are not met when no request completed.
+func (threshold Threshold) Evaluate(result *Result) ThresholdResult {
+	evaluation := ThresholdResult{Threshold: threshold}
+	evaluation.Actual = threshold.actual(result)
+	if threshold.isLatency() && result.CompletedCount == 0 {
+		return evaluation
+	}
+
+	switch threshold.Operator {
+	case "<":
+		evaluation.Passed = evaluation.Actual < threshold.Value
+	case "<=":
+		evaluation.Passed = evaluation.Actual <= threshold.Value
+	case ">":
+		evaluation.Passed = evaluation.Actual > threshold.Value
+	case ">=":
+		evaluation.Passed = evaluation.Actual >= threshold.Value
+	}
+	return evaluation
+}
+
+func (threshold *Threshold) actual(result *Result) float64 {
+	if percent, ok := threshold.percent(); ok {
+		return milliseconds(result.Percentile(percent / 100))
+	}
+
+	switch threshold.Metric {
+	case "min":
+		return milliseconds(result.LatencyStats().Min)
+	case "mean":
+		return milliseconds(result.LatencyStats().Mean)
+	case "max":
+		return milliseconds(result.LatencyStats().Max)
+	case "stddev":
+		return milliseconds(result.LatencyStats().StdDev)
+	case "error_rate":
+		if total := result.CompletedCount + result.ErrorCount; total > 0 {
+			return float64(result.ErrorCount) / float64(total)
+		}
+	case "failure_rate":
+		if result.CompletedCount > 0 {
+			return float64(result.Failures.Count) / float64(result.CompletedCount)
+		}
+	case "rate":
+		if result.OverallDuration > 0 {
+			return float64(result.CompletedCount) / result.OverallDuration.Seconds()
+		}
+	case "completed":
+		return float64(result.CompletedCount)
+	case "errors":
+		return float64(result.ErrorCount)
+	case "failures":
+		return float64(result.Failures.Count)
+	}
+	return 0
+}
+
+// Format formats a value of the metric of the threshold in its unit, such as 281ms, 0.52% or 613Hz.
+func (threshold *Threshold) Format(value float64) string {
+	return FormatMetric(threshold.Metric, value)
+}
+
+// FormatMetric formats a value of a metric, as named by a Threshold, in its unit.
+func FormatMetric(metric string, value float64) string {
+	switch {
+	case isLatencyMetric(metric):
+		return time.Duration(value * float64(time.Millisecond)).Round(time.Microsecond).String()
+	case isFractionMetric(metric):
+		return strconv.FormatFloat(100*value, 'g', 4, 64) + "%"
+	case metric == "rate":
+		return fmt.Sprintf("%.0fHz", value)
+	default:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+}
+
+// EvaluateThresholds evaluates thresholds on the result of a run, and returns whether all of them passed.
+func EvaluateThresholds(thresholds []Threshold, result *Result) ([]ThresholdResult, bool) {
+	evaluations := make([]ThresholdResult, len(thresholds))
+	passed := true
+	for i, threshold := range thresholds {
+		evaluations[i] = threshold.Evaluate(result)
+		passed = passed && evaluations[i].Passed
+	}
+	return evaluations, passed
+}
@@ -0,0 +1,109 @@
+package kurl_test
+
+import (
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseThreshold(t *testing.T) {
+	for expression, expected := range map[string]kurl.Threshold{
+		"p99<300ms":         {Metric: "p99", Operator: "<", Value: 300},
+		"p99.9 <= 1.5s":     {Metric: "p99.9", Operator: "<=", Value: 1500},
+		"avg<20":            {Metric: "mean", Operator: "<", Value: 20},
+		"error_rate<1%":     {Metric: "error_rate", Operator: "<", Value: 0.01},
+		"failure_rate<=0.1": {Metric: "failure_rate", Operator: "<=", Value: 0.1},
+		"rate>500":          {Metric: "rate", Operator: ">", Value: 500},
+		"rate>=500Hz":       {Metric: "rate", Operator: ">=", Value: 500},
+		"errors<1":          {Metric: "errors", Operator: "<", Value: 1},
+	} {
+		threshold, err := kurl.ParseThreshold(expression)
+		require.Nil(t, err, expression)
+		assert.Equal(t, expression, threshold.Expression)
+		assert.Equal(t, expected.Metric, threshold.Metric, expression)
+		assert.Equal(t, expected.Operator, threshold.Operator, expression)
+		assert.InDelta(t, expected.Value, threshold.Value, 1e-9, expression)
+	}
+
+	for _, expression := range []string{"", "p99", "p99=300ms", "p101<1s", "latency<1s", "p99<fast", "error_rate<one%"} {
+		_, err := kurl.ParseThreshold(expression)
+		assert.NotNil(t, err, expression)
+	}
+}
+
+func TestEvaluateThresholds(t *testing.T) {
+	result := &kurl.Result{
+		CompletedCount:  4,
+		ErrorCount:      1,
+		Failures:        kurl.ErrorSummary{Count: 1},
+		OverallDuration: time.Second,
+		Latencies:       []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond, 40 * time.Millisecond, 0},
+	}
+
+	evaluate := func(expression string) kurl.ThresholdResult {
+		threshold, err := kurl.ParseThreshold(expression)
+		require.Nil(t, err)
+		return threshold.Evaluate(result)
+	}
+
+	assert.True(t, evaluate("p50<=20ms").Passed)
+	assert.False(t, evaluate("p99<40ms").Passed)
+	assert.Equal(t, 40.0, evaluate("p99<40ms").Actual)
+	assert.True(t, evaluate("max<=40ms").Passed)
+	assert.True(t, evaluate("mean<30ms").Passed)
+	assert.False(t, evaluate("error_rate<10%").Passed)
+	assert.InDelta(t, 0.2, evaluate("error_rate<10%").Actual, 1e-9)
+	assert.True(t, evaluate("failure_rate<=25%").Passed)
+	assert.True(t, evaluate("rate>3").Passed)
+	assert.False(t, evaluate("completed>4").Passed)
+
+	thresholds := make([]kurl.Threshold, 0)
+	for _, expression := range []string{"p50<=20ms", "rate>3"} {
+		threshold, err := kurl.ParseThreshold(expression)
+		require.Nil(t, err)
+		thresholds = append(thresholds, threshold)
+	}
+	evaluations, passed := kurl.EvaluateThresholds(thresholds, result)
+	assert.True(t, passed)
+	assert.Len(t, evaluations, 2)
+
+	thresholds = append(thresholds, evaluate("p99<40ms").Threshold)
+	_, passed = kurl.EvaluateThresholds(thresholds, result)
+	assert.False(t, passed)
+
+	report := kurl.NewReport(kurl.Settings{}, result, nil)
+	evaluations, _ = kurl.EvaluateThresholds(thresholds, result)
+	report.AddThresholds(evaluations)
+	require.Len(t, report.Thresholds, 3)
+	assert.Equal(t, "p99<40ms", report.Thresholds[2].Expression)
+	assert.False(t, report.Thresholds[2].Passed)
+}
+
+func TestLatencyThresholdWithoutCompletedRequests(t *testing.T) {
+	threshold, err := kurl.ParseThreshold("p99<1s")
+	require.Nil(t, err)
+	assert.False(t, threshold.Evaluate(&kurl.Result{ErrorCount: 3}).Passed)
+
+	threshold, err = kurl.ParseThreshold("errors<5")
+	require.Nil(t, err)
+	assert.True(t, threshold.Evaluate(&kurl.Result{ErrorCount: 3}).Passed)
+}
+
+func TestFormatThreshold(t *testing.T) {
+	for expression, expected := range map[string]string{
+		"p99<300ms":     "281.5ms",
+		"error_rate<1%": "0.52%",
+		"rate>500":      "282Hz",
+		"completed>10":  "281.5",
+	} {
+		threshold, err := kurl.ParseThreshold(expression)
+		require.Nil(t, err)
+		value := 281.5
+		if threshold.Metric == "error_rate" {
+			value = 0.0052
+		}
+		assert.Equal(t, expected, threshold.Format(value), expression)
+	}
+}
@@ -0,0 +1,96 @@
+package kurl
+
+import (
+	"sync"
+	"time"
+)
+
+// intervalHistogramPrecision is the number of significant digits of the latency histogram of each interval,
+// lower than for the whole run since a long run has many intervals.
+const intervalHistogramPrecision = 2
+
+// Interval holds the statistics of the requests which completed during one interval of a run.
+type Interval struct {
+	Start                time.Duration // offset of the beginning of the interval from the start of the run
+	Duration             time.Duration // width of the interval, or less for the last interval which ends with the run
+	CompletedCount       int
+	ErrorCount           int
+	StatusCodesFrequency map[int]int
+	Histogram            *Histogram // latencies of the requests completed during the interval
+}
+
+// timeSeries records the outcome of requests in fixed-width intervals. It is shared by all workers.
+type timeSeries struct {
+	mutex     sync.Mutex
+	start     time.Time // set before workers are released
+	width     time.Duration
+	max       time.Duration
+	intervals []Interval
+}
+
+func newTimeSeries(settings *Settings) *timeSeries {
+	if settings.Interval <= 0 {
+		return nil
+	}
+	max := settings.HistogramMax
+	if max == 0 {
+		max = DefaultHistogramMax
+	}
+	return &timeSeries{
+		width: settings.Interval,
+		max:   max,
+	}
+}
+
+// record adds the outcome of a request which completed at end.
+func (ts *timeSeries) record(end time.Time, latency time.Duration, statusCode int, err error) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	interval := ts.grow(end.Sub(ts.start))
+	if err != nil {
+		interval.ErrorCount++
+		return
+	}
+	interval.CompletedCount++
+	interval.StatusCodesFrequency[statusCode]++
+	interval.Histogram.Record(latency)
+}
+
+// grow adds intervals until one covers offset, and returns that interval.
+func (ts *timeSeries) grow(offset time.Duration) *Interval {
+	if offset < 0 {
+		offset = 0
+	}
+	i := int(offset / ts.width)
+	for len(ts.intervals) <= i {
+		histogram, _ := NewHistogram(intervalHistogramPrecision, ts.max)
+		ts.intervals = append(ts.intervals, Interval{
+			Start:                time.Duration(len(ts.intervals)) * ts.width,
+			StatusCodesFrequency: make(map[int]int),
+			Histogram:            histogram,
+		})
+	}
+	return &ts.intervals[i]
+}
+
+// result returns the intervals of a run which lasted elapsed, including the intervals where nothing completed.
+func (ts *timeSeries) result(elapsed time.Duration) []Interval {
+	if ts == nil {
+		return nil
+	}
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	if elapsed > 0 {
+		ts.grow(elapsed - 1)
+	}
+	for i := range ts.intervals {
+		interval := &ts.intervals[i]
+		interval.Duration = ts.width
+		if interval.Start+ts.width > elapsed && elapsed > interval.Start {
+			interval.Duration = elapsed - interval.Start
+		}
+	}
+	return ts.intervals
+}
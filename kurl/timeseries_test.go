@@ -0,0 +1,103 @@
+package kurl_test
+
+import (
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIntervals(t *testing.T) {
+	lock := sync.Mutex{}
+	var firstRequest time.Time
+
+	// The server starts throttling halfway through the run
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		if firstRequest.IsZero() {
+			firstRequest = time.Now()
+		}
+		throttle := time.Since(firstRequest) > 300*time.Millisecond
+		lock.Unlock()
+
+		if throttle {
+			http.Error(rw, `TOO MANY REQUESTS`, http.StatusTooManyRequests)
+			return
+		}
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount: 2,
+		Duration:    600 * time.Millisecond,
+		Rate:        100,
+		Interval:    200 * time.Millisecond,
+	}
+
+	result, err := kurl.Do(
+		settings,
+		*request,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	// The requests sent right before the end of the run may complete in a 4th interval
+	require.LessOrEqual(t, 3, len(result.Intervals))
+	require.GreaterOrEqual(t, 4, len(result.Intervals))
+
+	completed := 0
+	var duration time.Duration
+	last := len(result.Intervals) - 1
+	for i, interval := range result.Intervals {
+		assert.Equal(t, time.Duration(i)*settings.Interval, interval.Start)
+		if i < last {
+			assert.Equal(t, settings.Interval, interval.Duration)
+		} else {
+			// The last interval ends with the run
+			assert.Less(t, int64(0), int64(interval.Duration))
+			assert.GreaterOrEqual(t, int64(settings.Interval), int64(interval.Duration))
+		}
+		duration += interval.Duration
+		assert.Equal(t, 0, interval.ErrorCount)
+		if i < 3 {
+			assert.InDelta(t, 20, interval.CompletedCount, 2)
+		}
+		require.NotNil(t, interval.Histogram)
+		assert.Equal(t, interval.CompletedCount, interval.Histogram.Count())
+		completed += interval.CompletedCount
+	}
+	assert.Equal(t, result.CompletedCount, completed)
+	assert.Equal(t, result.OverallDuration, duration)
+
+	assert.Equal(t, result.Intervals[0].CompletedCount, result.Intervals[0].StatusCodesFrequency[http.StatusOK])
+	assert.Equal(t, result.Intervals[2].CompletedCount, result.Intervals[2].StatusCodesFrequency[http.StatusTooManyRequests])
+}
+
+func TestIntervalsErrors(t *testing.T) {
+	request, err := http.NewRequest("GET", "http://localhost:9999", nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 5,
+		Interval:     time.Hour,
+	}
+
+	result, err := kurl.Do(
+		settings,
+		*request,
+	)
+	assert.Nil(t, err)
+	require.NotNil(t, result)
+	require.Equal(t, 1, len(result.Intervals))
+	assert.Equal(t, 10, result.Intervals[0].ErrorCount)
+	assert.Equal(t, 0, result.Intervals[0].CompletedCount)
+	assert.Equal(t, result.OverallDuration, result.Intervals[0].Duration)
+}
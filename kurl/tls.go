@@ -0,0 +1,162 @@
+package kurl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// TLSOptions describe the TLS configuration of a run in files and names, as given on a command line.
+// LoadTLSConfig turns them into the tls.Config of Settings.TLSConfig.
+type TLSOptions struct {
+	CACertFile   string   // PEM bundle of the certificate authorities trusted instead of the system ones
+	CertFile     string   // PEM client certificate presented to servers requiring mutual TLS, with KeyFile
+	KeyFile      string   // PEM private key of CertFile
+	Insecure     bool     // skip the verification of the server certificate
+	ServerName   string   // name sent with SNI and verified in the server certificate, instead of the host of the URL
+	MinVersion   string   // lowest TLS version, such as 1.2, default when empty
+	MaxVersion   string   // highest TLS version, such as 1.3, default when empty
+	CipherSuites []string // names of the TLS 1.0-1.2 cipher suites, such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, default when empty
+}
+
+// LoadTLSConfig reads the certificates and parses the names of the options into a tls.Config.
+func LoadTLSConfig(options TLSOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: options.Insecure,
+		ServerName:         options.ServerName,
+	}
+
+	if options.CACertFile != "" {
+		pem, err := ioutil.ReadFile(options.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("No PEM certificate found in " + options.CACertFile)
+		}
+	}
+
+	if options.CertFile != "" || options.KeyFile != "" {
+		if options.CertFile == "" || options.KeyFile == "" {
+			return nil, errors.New("A client certificate requires both a certificate and a key file")
+		}
+		certificate, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	var err error
+	if options.MinVersion != "" {
+		if config.MinVersion, err = ParseTLSVersion(options.MinVersion); err != nil {
+			return nil, err
+		}
+	}
+	if options.MaxVersion != "" {
+		if config.MaxVersion, err = ParseTLSVersion(options.MaxVersion); err != nil {
+			return nil, err
+		}
+	}
+	if config.MinVersion != 0 && config.MaxVersion != 0 && config.MinVersion > config.MaxVersion {
+		return nil, errors.New("The minimum TLS version cannot be above the maximum TLS version")
+	}
+
+	for _, name := range options.CipherSuites {
+		id, err := ParseCipherSuite(name)
+		if err != nil {
+			return nil, err
+		}
+		config.CipherSuites = append(config.CipherSuites, id)
+	}
+	return config, nil
+}
+
+// The names of the TLS versions, as reported in Result.TLSVersions.
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// The names of the cipher suites implemented by crypto/tls, as reported in Result.CipherSuites.
+// TLS 1.3 suites are always enabled and cannot be configured.
+var cipherSuites = map[uint16]string{
+	tls.TLS_RSA_WITH_RC4_128_SHA:                "TLS_RSA_WITH_RC4_128_SHA",
+	tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA:           "TLS_RSA_WITH_3DES_EDE_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA:            "TLS_RSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA:            "TLS_RSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA256:         "TLS_RSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256:         "TLS_RSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384:         "TLS_RSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA:        "TLS_ECDHE_ECDSA_WITH_RC4_128_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA:    "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA:    "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA:          "TLS_ECDHE_RSA_WITH_RC4_128_SHA",
+	tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA:     "TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA:      "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA:      "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256: "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256:   "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:   "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:   "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384: "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305:    "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305",
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305:  "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305",
+	tls.TLS_AES_128_GCM_SHA256:                  "TLS_AES_128_GCM_SHA256",
+	tls.TLS_AES_256_GCM_SHA384:                  "TLS_AES_256_GCM_SHA384",
+	tls.TLS_CHACHA20_POLY1305_SHA256:            "TLS_CHACHA20_POLY1305_SHA256",
+}
+
+// TLSVersionName returns the name of a TLS version, such as "TLS 1.3".
+func TLSVersionName(version uint16) string {
+	if name, ok := tlsVersions[version]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04X", version)
+}
+
+// ParseTLSVersion parses a TLS version such as "1.2", "tls1.2" or "TLS 1.2".
+func ParseTLSVersion(name string) (uint16, error) {
+	normalized := strings.TrimSpace(strings.TrimPrefix(strings.ToLower(name), "tls"))
+	for version, versionName := range tlsVersions {
+		if normalized == strings.TrimPrefix(versionName, "TLS ") {
+			return version, nil
+		}
+	}
+	return 0, errors.New("Unknown TLS version " + name + ", expected 1.0, 1.1, 1.2 or 1.3")
+}
+
+// CipherSuiteName returns the name of a cipher suite, such as "TLS_AES_128_GCM_SHA256".
+func CipherSuiteName(id uint16) string {
+	if name, ok := cipherSuites[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04X", id)
+}
+
+// The standard names of the ChaCha20 suites, which crypto/tls names without their _SHA256 suffix.
+var cipherSuiteAliases = map[string]uint16{
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256":   tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256": tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+}
+
+// ParseCipherSuite parses the name of a cipher suite, case insensitive.
+func ParseCipherSuite(name string) (uint16, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(name))
+	if id, ok := cipherSuiteAliases[normalized]; ok {
+		return id, nil
+	}
+	for id, suiteName := range cipherSuites {
+		if normalized == suiteName {
+			return id, nil
+		}
+	}
+	return 0, errors.New("Unknown cipher suite " + name)
+}
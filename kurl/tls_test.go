@@ -0,0 +1,232 @@
+package kurl_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePEM writes PEM blocks of the given type to a file of dir, and returns its path.
+func writePEM(t *testing.T, dir, name, blockType string, bytes []byte) string {
+	path := filepath.Join(dir, name)
+	require.Nil(t, ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: bytes}), 0600))
+	return path
+}
+
+// writeClientCertificate writes a self-signed client certificate and its key to dir, and returns their paths.
+func writeClientCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kurl"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+	return writePEM(t, dir, "client.pem", "CERTIFICATE", certificate), writePEM(t, dir, "client-key.pem", "EC PRIVATE KEY", keyBytes)
+}
+
+func newTLSRequest(t *testing.T, server *httptest.Server) *http.Request {
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+	return request
+}
+
+func TestTLSUntrustedServer(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	settings := kurl.Settings{ThreadCount: 1, RequestCount: 2}
+	result, err := kurl.Do(settings, *newTLSRequest(t, server))
+	require.Nil(t, err)
+	assert.Equal(t, 0, result.CompletedCount)
+	assert.Equal(t, settings.RequestCount, result.Errors[kurl.ErrorTLS].Count)
+}
+
+func TestTLSInsecure(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	config, err := kurl.LoadTLSConfig(kurl.TLSOptions{Insecure: true})
+	require.Nil(t, err)
+
+	settings := kurl.Settings{ThreadCount: 2, RequestCount: 3, TLSConfig: config}
+	result, err := kurl.Do(settings, *newTLSRequest(t, server))
+	require.Nil(t, err)
+	require.Equal(t, settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+
+	// Each thread opens one connection with one handshake
+	assert.Equal(t, map[string]int{"TLS 1.3": result.CompletedCount}, result.TLSVersions)
+	assert.Len(t, result.CipherSuites, 1)
+	assert.Equal(t, settings.ThreadCount, result.TLSHandshakes.Count())
+	assert.Greater(t, int64(result.TLSHandshakes.Min()), int64(0))
+
+	report := kurl.NewReport(settings, result, []float64{50})
+	require.NotNil(t, report.TLS)
+	assert.Equal(t, result.TLSVersions, report.TLS.Versions)
+	require.NotNil(t, report.TLS.Handshake)
+	assert.Equal(t, settings.ThreadCount, report.TLS.Handshake.Count)
+}
+
+func TestTLSCACertAndServerName(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(req.TLS.ServerName))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "kurl")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	caCertFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+	// The certificate of the test server is valid for its IP address and for example.com
+	for serverName, completed := range map[string]bool{"": true, "example.com": true, "other.com": false} {
+		config, err := kurl.LoadTLSConfig(kurl.TLSOptions{CACertFile: caCertFile, ServerName: serverName})
+		require.Nil(t, err)
+
+		settings := kurl.Settings{ThreadCount: 1, RequestCount: 1, TLSConfig: config, KeepBody: true}
+		tests := []kurl.Test{func(resp *http.Response, latency time.Duration) error {
+			body, err := ioutil.ReadAll(resp.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, serverName, string(body))
+			return nil
+		}}
+		result, err := kurl.DoManyTest(settings, []*http.Request{newTLSRequest(t, server)}, tests)
+		require.Nil(t, err)
+		if completed {
+			assert.Equal(t, 1, result.CompletedCount, serverName)
+		} else {
+			assert.Equal(t, 1, result.Errors[kurl.ErrorTLS].Count, serverName)
+		}
+	}
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`OK`))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "kurl")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeClientCertificate(t, dir)
+
+	// Without a client certificate the server rejects the connection
+	config, err := kurl.LoadTLSConfig(kurl.TLSOptions{Insecure: true})
+	require.Nil(t, err)
+	settings := kurl.Settings{ThreadCount: 1, RequestCount: 1, TLSConfig: config}
+	result, err := kurl.Do(settings, *newTLSRequest(t, server))
+	require.Nil(t, err)
+	assert.Equal(t, 0, result.CompletedCount)
+
+	config, err = kurl.LoadTLSConfig(kurl.TLSOptions{Insecure: true, CertFile: certFile, KeyFile: keyFile})
+	require.Nil(t, err)
+	settings.TLSConfig = config
+	result, err = kurl.Do(settings, *newTLSRequest(t, server))
+	require.Nil(t, err)
+	assert.Equal(t, 1, result.CompletedCount)
+
+	_, err = kurl.LoadTLSConfig(kurl.TLSOptions{CertFile: certFile})
+	assert.NotNil(t, err)
+	_, err = kurl.LoadTLSConfig(kurl.TLSOptions{CACertFile: keyFile})
+	assert.NotNil(t, err)
+}
+
+func TestTLSVersionAndCipherSuite(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	config, err := kurl.LoadTLSConfig(kurl.TLSOptions{
+		Insecure:     true,
+		MaxVersion:   "1.2",
+		CipherSuites: []string{"tls_ecdhe_rsa_with_chacha20_poly1305_sha256"},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MaxVersion)
+
+	settings := kurl.Settings{ThreadCount: 1, RequestCount: 2, TLSConfig: config}
+	result, err := kurl.Do(settings, *newTLSRequest(t, server))
+	require.Nil(t, err)
+	assert.Equal(t, map[string]int{"TLS 1.2": 2}, result.TLSVersions)
+	assert.Equal(t, map[string]int{"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305": 2}, result.CipherSuites)
+
+	_, err = kurl.LoadTLSConfig(kurl.TLSOptions{MinVersion: "1.3", MaxVersion: "1.2"})
+	assert.NotNil(t, err)
+	_, err = kurl.LoadTLSConfig(kurl.TLSOptions{MinVersion: "1.4"})
+	assert.NotNil(t, err)
+	_, err = kurl.LoadTLSConfig(kurl.TLSOptions{CipherSuites: []string{"TLS_NOPE"}})
+	assert.NotNil(t, err)
+}
+
+func TestTLSNames(t *testing.T) {
+	for name, expected := range map[string]uint16{
+		"1.0":     tls.VersionTLS10,
+		"tls1.1":  tls.VersionTLS11,
+		"TLS 1.2": tls.VersionTLS12,
+		"1.3":     tls.VersionTLS13,
+	} {
+		version, err := kurl.ParseTLSVersion(name)
+		require.Nil(t, err, name)
+		assert.Equal(t, expected, version, name)
+	}
+	assert.Equal(t, "TLS 1.3", kurl.TLSVersionName(tls.VersionTLS13))
+	assert.Equal(t, "0x0300", kurl.TLSVersionName(0x0300))
+
+	suite, err := kurl.ParseCipherSuite("TLS_AES_128_GCM_SHA256")
+	require.Nil(t, err)
+	assert.Equal(t, uint16(tls.TLS_AES_128_GCM_SHA256), suite)
+	assert.Equal(t, "TLS_AES_128_GCM_SHA256", kurl.CipherSuiteName(suite))
+	assert.Equal(t, "0xFFFF", kurl.CipherSuiteName(0xFFFF))
+}
+
+func TestTLSProtocol(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`OK`))
+	}))
+	server.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	server.StartTLS()
+	defer server.Close()
+
+	config, err := kurl.LoadTLSConfig(kurl.TLSOptions{Insecure: true})
+	require.Nil(t, err)
+
+	for protocol, expected := range map[kurl.Protocol]string{
+		kurl.ProtocolAuto:  "HTTP/2.0",
+		kurl.ProtocolHTTP1: "HTTP/1.1",
+		kurl.ProtocolHTTP2: "HTTP/2.0",
+	} {
+		settings := kurl.Settings{ThreadCount: 2, RequestCount: 2, TLSConfig: config, Protocol: protocol}
+		result, err := kurl.Do(settings, *newTLSRequest(t, server))
+		require.Nil(t, err)
+		assert.Equal(t, map[string]int{expected: settings.ThreadCount * settings.RequestCount}, result.Protocols, string(protocol))
+	}
+}
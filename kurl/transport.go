@@ -0,0 +1,237 @@
+package kurl
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"golang.org/x/net/http2"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocol is the HTTP version requests are sent with.
+type Protocol string
+
+// The protocols of Settings.Protocol.
+const (
+	ProtocolAuto  Protocol = ""      // HTTP/2 when the server negotiates it over TLS, HTTP/1.1 otherwise
+	ProtocolHTTP1 Protocol = "http1" // HTTP/1.1 only
+	ProtocolHTTP2 Protocol = "http2" // HTTP/2 over TLS only, with https URLs, a response of another version is an error
+	ProtocolH2C   Protocol = "h2c"   // HTTP/2 over cleartext TCP, with prior knowledge that the server speaks it, with http URLs
+)
+
+// errNotHTTP2 is the error of a response which is not HTTP/2 although settings.Protocol requires it.
+var errNotHTTP2 = errors.New("The server did not negotiate HTTP/2")
+
+// validateTransport returns an error if the transport settings are invalid.
+func validateTransport(settings *Settings) error {
+	switch settings.Protocol {
+	case ProtocolAuto, ProtocolHTTP1, ProtocolHTTP2:
+	case ProtocolH2C:
+		// The HTTP/2 transport multiplexes requests on one connection it keeps open, and has no such limits
+		if settings.DisableKeepAlives || settings.MaxConnsPerHost > 0 || settings.MaxIdleConnsPerHost > 0 || settings.IdleConnTimeout > 0 {
+			return errors.New("settings.Protocol h2c cannot be used with DisableKeepAlives, MaxConnsPerHost, MaxIdleConnsPerHost or IdleConnTimeout")
+		}
+	default:
+		return errors.New("settings.Protocol must be empty, http1, http2 or h2c")
+	}
+	if settings.MaxConnsPerHost < 0 {
+		return errors.New("settings.MaxConnsPerHost cannot be negative")
+	}
+	if settings.MaxIdleConnsPerHost < 0 {
+		return errors.New("settings.MaxIdleConnsPerHost cannot be negative")
+	}
+	if settings.IdleConnTimeout < 0 {
+		return errors.New("settings.IdleConnTimeout cannot be negative")
+	}
+	return nil
+}
+
+// validateScheme returns an error if the protocol of settings cannot send requests to rawURL,
+// such as HTTP/2 over TLS to an http URL. A templated URL is only checked if its scheme is literal.
+func validateScheme(settings *Settings, rawURL string) error {
+	rawURL = strings.ToLower(rawURL)
+	switch {
+	case settings.Protocol == ProtocolHTTP2 && strings.HasPrefix(rawURL, "http://"):
+		return errors.New("settings.Protocol http2 requires https URLs, use h2c for HTTP/2 over cleartext")
+	case settings.Protocol == ProtocolH2C && strings.HasPrefix(rawURL, "https://"):
+		return errors.New("settings.Protocol h2c requires http URLs, use http2 for HTTP/2 over TLS")
+	}
+	return nil
+}
+
+// newTransport returns a transport configured by settings, for the given number of threads.
+func newTransport(settings *Settings, threadCount int) http.RoundTripper {
+	if settings.Protocol == ProtocolH2C {
+		return newH2CTransport()
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = settings.DisableKeepAlives
+	transport.MaxConnsPerHost = settings.MaxConnsPerHost
+	transport.MaxIdleConns = 0
+	transport.MaxIdleConnsPerHost = settings.MaxIdleConnsPerHost
+	if transport.MaxIdleConnsPerHost == 0 {
+		// Let every thread keep its connection between requests
+		transport.MaxIdleConnsPerHost = threadCount
+	}
+	if settings.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = settings.IdleConnTimeout
+	}
+	if settings.TLSConfig != nil {
+		transport.TLSClientConfig = settings.TLSConfig.Clone()
+	}
+
+	switch settings.Protocol {
+	case ProtocolHTTP1:
+		// A non-nil map disables HTTP/2
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	case ProtocolHTTP2:
+		transport.ForceAttemptHTTP2 = true
+	}
+	return transport
+}
+
+// newH2CTransport returns an HTTP/2 transport which dials plain TCP connections instead of TLS ones.
+// Dials are bound to the context of the request, so that the end of a run and Settings.Timeout abort them.
+func newH2CTransport() *http2.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, config *tls.Config) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// newClients returns the clients of threadCount workers, each with its own transport and connections,
+// or all sharing one transport when settings.SharedTransport is set.
+// The transport of each worker is wrapped by settings.Transport if set, then by a measuredTransport.
+func newClients(settings *Settings, threadCount int) ([]*http.Client, error) {
+	var shared http.RoundTripper
+	if settings.SharedTransport {
+		shared = newTransport(settings, threadCount)
+	}
+
+	clients := make([]*http.Client, threadCount)
+	for i := range clients {
+		transport := shared
+		if shared == nil {
+			transport = newTransport(settings, 1)
+		}
+		if settings.Transport != nil {
+			if transport = settings.Transport(transport); transport == nil {
+				return nil, errors.New("settings.Transport cannot return nil")
+			}
+		}
+		clients[i] = &http.Client{
+			Timeout:   settings.Timeout,
+			Transport: &measuredTransport{next: transport},
+		}
+	}
+	return clients, nil
+}
+
+// measuredTransport wraps the transport of a worker to time the responses of its requests,
+// whichever RoundTripper sends them.
+type measuredTransport struct {
+	next      http.RoundTripper
+	mutex     sync.Mutex // a timed out request may still be in flight when the worker sends the next one
+	responded time.Time  // when the headers of the last response were received
+}
+
+// RoundTrip implements http.RoundTripper.
+func (transport *measuredTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	resp, err := transport.next.RoundTrip(request)
+	transport.mutex.Lock()
+	transport.responded = time.Now()
+	transport.mutex.Unlock()
+	return resp, err
+}
+
+// lastResponse returns when the headers of the last response were received.
+func (transport *measuredTransport) lastResponse() time.Time {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+	return transport.responded
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport, if it keeps any.
+func (transport *measuredTransport) CloseIdleConnections() {
+	if closer, ok := transport.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// closeIdleConnections closes the connections the flows left open after the run.
+func closeIdleConnections(flows []*flow) {
+	for _, f := range flows {
+		for _, s := range f.senders {
+			s.client.CloseIdleConnections()
+		}
+	}
+}
+
+// connTracker records the connection of the last request of a worker:
+// whether it was reused, and how long its TLS handshake took if it was opened for the request.
+type connTracker struct {
+	mutex     sync.Mutex // the transport may call the trace hooks from its own goroutines
+	reused    bool
+	tlsStart  time.Time
+	handshake time.Duration // 0 when there was no TLS handshake
+}
+
+// withTrace returns a context which reports the connections of the requests it is attached to, to this tracker.
+func (tracker *connTracker) withTrace(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		TLSHandshakeStart: func() {
+			tracker.mutex.Lock()
+			tracker.tlsStart = time.Now()
+			tracker.mutex.Unlock()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			tracker.mutex.Lock()
+			if err == nil && !tracker.tlsStart.IsZero() {
+				tracker.handshake = time.Since(tracker.tlsStart)
+			}
+			tracker.mutex.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			tracker.mutex.Lock()
+			tracker.reused = info.Reused
+			tracker.mutex.Unlock()
+		},
+	})
+}
+
+// reset forgets the connection of the previous request.
+func (tracker *connTracker) reset() {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.reused = false
+	tracker.tlsStart = time.Time{}
+	tracker.handshake = 0
+}
+
+// last returns whether the last request was sent on a reused connection, and the duration of its TLS handshake.
+func (tracker *connTracker) last() (reused bool, handshake time.Duration) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	return tracker.reused, tracker.handshake
+}
+
+// ConnectionReuseRatio returns the fraction of completed requests which were sent on a reused connection.
+func (result *Result) ConnectionReuseRatio() float64 {
+	if result.CompletedCount == 0 {
+		return 0
+	}
+	return float64(result.ConnectionsReused) / float64(result.CompletedCount)
+}
@@ -0,0 +1,274 @@
+package kurl_test
+
+import (
+	"github.com/mipnw/kurl/kurl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newConnCountingServer returns a server which counts the connections it accepts.
+func newConnCountingServer() (*httptest.Server, func() int) {
+	var lock sync.Mutex
+	conns := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`OK`))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			lock.Lock()
+			conns++
+			lock.Unlock()
+		}
+	}
+	server.Start()
+	return server, func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return conns
+	}
+}
+
+func TestConnectionReuse(t *testing.T) {
+	server, conns := newConnCountingServer()
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 5,
+	}
+	result, err := kurl.Do(settings, *request)
+	require.Nil(t, err)
+	require.Equal(t, settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+
+	// Each thread opens its own connection, and keeps it
+	assert.Equal(t, settings.ThreadCount, conns())
+	assert.Equal(t, result.CompletedCount-settings.ThreadCount, result.ConnectionsReused)
+	assert.InDelta(t, 0.8, result.ConnectionReuseRatio(), 1e-9)
+	assert.Equal(t, map[string]int{"HTTP/1.1": result.CompletedCount}, result.Protocols)
+
+	report := kurl.NewReport(settings, result, nil)
+	assert.InDelta(t, 0.8, report.ReuseRatio, 1e-9)
+	assert.Equal(t, result.Protocols, report.Protocols)
+}
+
+func TestDisableKeepAlives(t *testing.T) {
+	server, conns := newConnCountingServer()
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:       2,
+		RequestCount:      5,
+		DisableKeepAlives: true,
+	}
+	result, err := kurl.Do(settings, *request)
+	require.Nil(t, err)
+	require.Equal(t, settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+
+	assert.Equal(t, result.CompletedCount, conns())
+	assert.Equal(t, 0, result.ConnectionsReused)
+	assert.Equal(t, 0.0, result.ConnectionReuseRatio())
+}
+
+func TestSharedTransport(t *testing.T) {
+	server, conns := newConnCountingServer()
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	// All threads share a single connection, one request at a time
+	settings := kurl.Settings{
+		ThreadCount:     4,
+		RequestCount:    5,
+		SharedTransport: true,
+		MaxConnsPerHost: 1,
+	}
+	result, err := kurl.Do(settings, *request)
+	require.Nil(t, err)
+	require.Equal(t, settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+
+	assert.Equal(t, 1, conns())
+	assert.Equal(t, result.CompletedCount-1, result.ConnectionsReused)
+}
+
+func TestProtocol(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 2,
+		Protocol:     kurl.ProtocolHTTP1,
+	}
+	result, err := kurl.Do(settings, *request)
+	require.Nil(t, err)
+	assert.Equal(t, map[string]int{"HTTP/1.1": settings.ThreadCount * settings.RequestCount}, result.Protocols)
+
+	// HTTP/2 over TLS cannot be forced on a cleartext URL
+	settings.Protocol = kurl.ProtocolHTTP2
+	_, err = kurl.Do(settings, *request)
+	assert.NotNil(t, err)
+	_, err = kurl.DoScenario(settings, kurl.Scenario{Steps: []kurl.Step{{URL: server.URL + "/{{.path}}"}}})
+	assert.NotNil(t, err)
+
+	// The server does not speak HTTP/2 over cleartext
+	settings.Protocol = kurl.ProtocolH2C
+	result, err = kurl.Do(settings, *request)
+	require.Nil(t, err)
+	assert.Equal(t, 0, result.CompletedCount)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.ErrorCount)
+
+	settings.Protocol = "spdy"
+	_, err = kurl.Do(settings, *request)
+	assert.NotNil(t, err)
+}
+
+func TestH2C(t *testing.T) {
+	server := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(req.Proto))
+	}), &http2.Server{}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	settings := kurl.Settings{
+		ThreadCount:  2,
+		RequestCount: 3,
+		Protocol:     kurl.ProtocolH2C,
+	}
+	result, err := kurl.Do(settings, *request)
+	require.Nil(t, err)
+	assert.Equal(t, map[string]int{"HTTP/2.0": settings.ThreadCount * settings.RequestCount}, result.Protocols)
+
+	// Each thread multiplexes its requests on one connection
+	assert.Equal(t, result.CompletedCount-settings.ThreadCount, result.ConnectionsReused)
+
+	settings.SharedTransport = true
+	settings.Warm = true
+	result, err = kurl.Do(settings, *request)
+	require.Nil(t, err)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+
+	// h2c requires an http URL, and its transport has no connection limits
+	settings.SharedTransport = false
+	settings.MaxConnsPerHost = 1
+	_, err = kurl.Do(settings, *request)
+	assert.NotNil(t, err)
+	settings.MaxConnsPerHost = 0
+	request, err = http.NewRequest("GET", strings.Replace(server.URL, "http://", "https://", 1), nil)
+	require.Nil(t, err)
+	_, err = kurl.Do(settings, *request)
+	assert.NotNil(t, err)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+func TestInMemoryTransport(t *testing.T) {
+	var lock sync.Mutex
+	created := 0
+	settings := kurl.Settings{
+		ThreadCount:  3,
+		RequestCount: 4,
+		Transport: func(base http.RoundTripper) http.RoundTripper {
+			lock.Lock()
+			created++
+			lock.Unlock()
+			return roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+				time.Sleep(time.Millisecond)
+				return &http.Response{
+					Status:     "200 OK",
+					StatusCode: http.StatusOK,
+					Proto:      "HTTP/1.1",
+					ProtoMajor: 1,
+					ProtoMinor: 1,
+					Body:       ioutil.NopCloser(strings.NewReader(`OK`)),
+					Request:    request,
+				}, nil
+			})
+		},
+	}
+
+	// Nothing listens on this address
+	request, err := http.NewRequest("GET", "http://kurl.invalid/", nil)
+	require.Nil(t, err)
+
+	result, err := kurl.Do(settings, *request)
+	require.Nil(t, err)
+	assert.Equal(t, settings.ThreadCount, created)
+	assert.Equal(t, settings.ThreadCount*settings.RequestCount, result.CompletedCount)
+	assert.Equal(t, map[int]int{http.StatusOK: result.CompletedCount}, result.StatusCodesFrequency)
+	assert.Equal(t, int64(2*result.CompletedCount), result.BytesReceived)
+	assert.Equal(t, map[string]int{"HTTP/1.1": result.CompletedCount}, result.Protocols)
+	assert.Equal(t, result.CompletedCount, result.TimeToFirstByte.Count())
+	assert.LessOrEqual(t, int64(time.Millisecond), int64(result.TimeToFirstByte.Min()))
+}
+
+func TestTransportMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer token" {
+			rw.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("GET", server.URL, nil)
+	require.Nil(t, err)
+
+	var lock sync.Mutex
+	bases := make(map[http.RoundTripper]bool)
+	settings := kurl.Settings{
+		ThreadCount:     3,
+		RequestCount:    2,
+		SharedTransport: true,
+		Transport: func(base http.RoundTripper) http.RoundTripper {
+			lock.Lock()
+			bases[base] = true
+			lock.Unlock()
+			return roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+				request = request.Clone(request.Context())
+				request.Header.Set("Authorization", "Bearer token")
+				return base.RoundTrip(request)
+			})
+		},
+	}
+
+	result, err := kurl.Do(settings, *request)
+	require.Nil(t, err)
+	assert.Equal(t, map[int]int{http.StatusOK: settings.ThreadCount * settings.RequestCount}, result.StatusCodesFrequency)
+
+	// The middleware wraps kurl's own transport, shared by all threads, which still reports connection reuse
+	assert.Len(t, bases, 1)
+	assert.Less(t, 0, result.ConnectionsReused)
+
+	settings.Transport = func(base http.RoundTripper) http.RoundTripper {
+		return nil
+	}
+	_, err = kurl.Do(settings, *request)
+	assert.NotNil(t, err)
+}
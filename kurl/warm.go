@@ -0,0 +1,107 @@
+package kurl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// warmCount returns how many requests each thread sends to warm up, when settings.WarmDuration is 0.
+func (settings *Settings) warmCount() int {
+	if settings.WarmCount == 0 && settings.Warm {
+		return 1
+	}
+	return settings.WarmCount
+}
+
+// warms returns whether settings require a warm-up before the run.
+func (settings *Settings) warms() bool {
+	return settings.WarmDuration > 0 || settings.warmCount() > 0
+}
+
+// warmAll warms up all flows concurrently, each with the clients of its own worker, and returns the first failure.
+// A failure aborts the warm-up of the other flows. When ctx is done, the warm-up stops without failure.
+func warmAll(ctx context.Context, settings *Settings, flows []*flow) error {
+	warmCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var complete sync.WaitGroup
+	var once sync.Once
+	var failure error
+	for _, f := range flows {
+		complete.Add(1)
+		go func(f *flow) {
+			defer complete.Done()
+			if err := f.warm(warmCtx, settings); err != nil {
+				once.Do(func() {
+					failure = err
+					cancel()
+				})
+			}
+		}(f)
+	}
+	complete.Wait()
+
+	// The requests which failed because ctx is done are an interruption, not a failure
+	if failure != nil && ctx.Err() == nil {
+		return errors.New("Warm failed: " + failure.Error())
+	}
+	return nil
+}
+
+// warm runs the flow for settings.WarmDuration, or settings.warmCount() times, without recording anything,
+// to open connections and prime the server before the run. Think times are skipped.
+func (f *flow) warm(ctx context.Context, settings *Settings) error {
+	deadline := time.Now().Add(settings.WarmDuration)
+	count := settings.warmCount()
+	for i := 0; ; i++ {
+		if settings.WarmDuration > 0 {
+			if !time.Now().Before(deadline) {
+				return nil
+			}
+		} else if i >= count {
+			return nil
+		}
+		if f.feed != nil {
+			f.feed.next(f.vars)
+		}
+		for _, s := range f.senders {
+			if err := s.warm(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// warm sends the sender's request once without recording anything.
+// The warm-up is not traced, gets its own copy of the body, and extracts values like measured requests.
+func (s *sender) warm(ctx context.Context) error {
+	request, err := s.nextRequest()
+	if err != nil {
+		return err
+	}
+	request = request.WithContext(ctx)
+	if request.GetBody != nil {
+		body, err := request.GetBody()
+		if err != nil {
+			return err
+		}
+		request.Body = body
+	}
+
+	resp, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	if _, err := readBody(resp, s.extractsFromBody()); err != nil {
+		return err
+	}
+	if err := s.checkProtocol(resp); err != nil {
+		return err
+	}
+	if s.extractions != nil {
+		s.extractAll(resp)
+	}
+	return nil
+}
@@ -1,58 +1,354 @@
 package kurl
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"sync"
 	"time"
 )
 
 type workerResult struct {
+	mutex            sync.Mutex // guards the fields below, which are read by the progress reporter during the run
+	completedCount   int
 	errorCount       int
+	errors           map[ErrorCategory]ErrorSummary
+	failures         ErrorSummary
 	statusCodesCount map[int]int
 	latency          []time.Duration
+	histogram        *Histogram           // replaces latency when not nil
+	recent           *Histogram           // latencies since the last progress report, nil when progress is not reported
+	timeSeries       *timeSeries          // shared by all workers, nil when no time series is recorded
+	stages           *stageSeries         // shared by all workers, nil when there is no load profile
+	phases           map[Phase]*Histogram // nil when phases are not traced
+	firstByte        *Histogram           // time to the first byte of completed requests
+	bytesReceived    int64
+	bytesSent        int64
+	protocols        map[string]int // completed requests by protocol of the response
+	reused           int            // completed requests sent on a reused connection
+	tlsVersions      map[string]int // completed requests by TLS version, over TLS
+	cipherSuites     map[string]int // completed requests by cipher suite, over TLS
+	handshakes       *Histogram     // durations of the TLS handshakes of completed requests which opened a connection
 }
 
-func worker(
+// init prepares a worker result to record the run described by settings.
+func (result *workerResult) init(settings *Settings, timeSeries *timeSeries, stages *stageSeries) {
+	result.timeSeries = timeSeries
+	result.stages = stages
+	result.statusCodesCount = make(map[int]int)
+	result.errors = make(map[ErrorCategory]ErrorSummary)
+	result.protocols = make(map[string]int)
+	result.tlsVersions = make(map[string]int)
+	result.cipherSuites = make(map[string]int)
+	result.handshakes, _ = newHistogram(settings)
+	result.firstByte, _ = newHistogram(settings)
+	if settings.HistogramPrecision != 0 {
+		result.histogram, _ = newHistogram(settings)
+	} else if settings.Duration == 0 && settings.Rate == 0 && settings.Stages == nil {
+		result.latency = make([]time.Duration, 0, settings.RequestCount)
+	}
+	if settings.Progress != nil {
+		result.recent, _ = newHistogram(settings)
+	}
+	if settings.TracePhases {
+		result.phases = newPhaseHistograms(settings)
+	}
+}
+
+// sender issues the requests of one worker and records their outcome.
+type sender struct {
+	settings    *Settings
+	client      *http.Client
+	keepBody    bool              // keep response bodies in memory for the test
+	ctx         context.Context   // the requests are bound to this context
+	request     *http.Request     // nil when template is set
+	template    *requestTemplate  // renders a new request before every send, nil for a fixed request
+	extractions []*extraction     // values saved from every response into vars
+	vars        map[string]string // variables of the worker, shared by the senders of its flow
+	tracer      *phaseTracer      // nil when phases are not traced
+	conns       *connTracker
+	test        Test
+	result      *workerResult
+}
+
+// newSender prepares a worker to send a copy of request with client, bound to ctx.
+// Each worker gets its own copy since http.Client.Do may modify the request.
+func newSender(
+	ctx context.Context,
 	settings *Settings,
-	request http.Request,
+	client *http.Client,
+	request *http.Request,
 	test Test,
+	result *workerResult,
+) *sender {
+	s := &sender{
+		settings: settings,
+		client:   client,
+		keepBody: settings.KeepBody,
+		conns:    &connTracker{},
+		test:     test,
+		result:   result,
+	}
+	ctx = s.conns.withTrace(ctx)
+	if settings.TracePhases {
+		s.tracer = newPhaseTracer()
+		ctx = s.tracer.withTrace(ctx)
+	}
+	s.ctx = ctx
+	if request != nil {
+		s.request = request.WithContext(ctx)
+	}
+	return s
+}
+
+// nextRequest returns the request to send, rendered from the worker's variables if the sender has a template.
+func (s *sender) nextRequest() (*http.Request, error) {
+	if s.template == nil {
+		return s.request, nil
+	}
+	return s.template.render(s.ctx, s.vars)
+}
+
+// flow is the sequence of requests a worker sends on every iteration: a single request, or the steps of a scenario.
+type flow struct {
+	senders    []*sender
+	thinkTimes []time.Duration   // pause after each request, nil when there is none
+	vars       map[string]string // variables of the worker for the templates of the senders, nil when there is none
+	feed       *feed             // sets a row of data in vars before every run of the flow, nil when there is none
+}
+
+// run sends every request of the flow once, in order, unless ctx is done.
+// The latency of the first request is measured from the intended send time, the others from when they are sent.
+func (f *flow) run(ctx context.Context, intended time.Time) {
+	if f.feed != nil {
+		f.feed.next(f.vars)
+	}
+	for i, s := range f.senders {
+		if ctx.Err() != nil {
+			return
+		}
+		if i > 0 {
+			intended = time.Now()
+		}
+		s.issue(intended)
+		if f.thinkTimes != nil && f.thinkTimes[i] > 0 {
+			sleep(ctx, f.thinkTimes[i])
+		}
+	}
+}
+
+func worker(
+	ctx context.Context,
+	settings *Settings,
+	flow *flow,
+	profile *loadProfile, // nil when the load is constant
+	index int,
 	begin *sync.WaitGroup,
 	ready *sync.WaitGroup,
 	complete *sync.WaitGroup,
-	result *workerResult,
 ) {
 	defer complete.Done()
 
-	client := &http.Client{
-		Timeout: settings.Timeout,
-	}
-
 	ready.Done()
 
 	begin.Wait()
-	for i := 0; i < settings.RequestCount; i++ {
-
+	if profile != nil {
+		profile.run(ctx, settings, flow, index)
+		return
+	}
+	deadline := time.Now().Add(settings.Duration)
+	for i := 0; keepGoing(ctx, settings, i, deadline); i++ {
 		start := time.Now()
-		resp, err := client.Do(&request)
-		result.latency[i] = time.Since(start)
+		flow.run(ctx, start)
+
+		// Delay this thread if we need to wait between requests
+		elapsedSinceLastRequest := time.Since(start)
+		if elapsedSinceLastRequest < settings.WaitBetweenRequests {
+			sleep(ctx, settings.WaitBetweenRequests-elapsedSinceLastRequest)
+		}
+	}
+}
 
-		start = time.Now()
+// keepGoing returns whether a worker which already issued i requests should issue another one.
+// A non-zero settings.Duration takes precedence over settings.RequestCount.
+func keepGoing(ctx context.Context, settings *Settings, i int, deadline time.Time) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if settings.Duration > 0 {
+		return time.Now().Before(deadline)
+	}
+	return i < settings.RequestCount
+}
+
+// sleep pauses for duration d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// issue sends one request and records its outcome, with latencies measured from the intended send time.
+func (s *sender) issue(intended time.Time) {
+	if s.tracer != nil {
+		s.tracer.reset()
+	}
+	s.conns.reset()
+
+	request, err := s.nextRequest()
+	if err != nil {
+		s.record(nil, err, 0, 0, 0, 0)
+		return
+	}
+
+	// Every request gets a fresh copy of the body
+	var body *countingReader
+	if request.GetBody != nil {
+		reader, err := request.GetBody()
 		if err != nil {
-			result.errorCount++
-			result.latency[i] = 0 // flagging so we can remove those later
-		} else {
-			result.statusCodesCount[resp.StatusCode]++
+			s.record(nil, err, 0, 0, 0, 0)
+			return
 		}
+		request.Body = reader
+		if reader != http.NoBody {
+			body = &countingReader{ReadCloser: reader}
+			request.Body = body
+		}
+	}
+
+	resp, err := s.client.Do(request)
+	firstByte := time.Since(intended)
+	if transport, ok := s.client.Transport.(*measuredTransport); ok && err == nil {
+		// Redirects and retries are part of the time to the first byte of the final response
+		firstByte = transport.lastResponse().Sub(intended)
+	}
+	var received int64
+	if err == nil {
+		received, err = readBody(resp, s.keepBody || s.extractsFromBody())
+	}
+	latency := time.Since(intended)
+	if err == nil {
+		err = s.checkProtocol(resp)
+	}
+	if err == nil && s.tracer != nil {
+		s.tracer.bodyRead()
+	}
+
+	// A request aborted because the run was interrupted says nothing about the endpoint
+	if err != nil && s.ctx.Err() != nil {
+		return
+	}
+
+	if err == nil && s.extractions != nil {
+		s.extractAll(resp)
+	}
+
+	var sent int64
+	if body != nil {
+		sent = body.read()
+	}
+	s.record(resp, err, latency, firstByte, received, sent)
+}
+
+// record adds the outcome of one request to the worker's result.
+func (s *sender) record(
+	resp *http.Response,
+	err error,
+	latency time.Duration,
+	firstByte time.Duration,
+	received int64,
+	sent int64,
+) {
+	// Run the test if we have one, on the responses of completed requests only
+	var failure error
+	if err == nil && s.test != nil {
+		failure = s.test(resp, latency)
+	}
 
-		// Run the test if we have one
-		if test != nil {
-			test(resp, result.latency[i])
+	result := s.result
+	result.mutex.Lock()
+	if err != nil {
+		result.errorCount++
+		addError(result.errors, err)
+		latency = 0 // flagging so we can remove those later
+	} else {
+		result.completedCount++
+		result.statusCodesCount[resp.StatusCode]++
+		result.bytesReceived += received
+		result.bytesSent += sent
+		result.firstByte.Record(firstByte)
+		if resp.Proto != "" {
+			result.protocols[resp.Proto]++
+		}
+		reused, handshake := s.conns.last()
+		if reused {
+			result.reused++
+		}
+		if resp.TLS != nil {
+			result.tlsVersions[TLSVersionName(resp.TLS.Version)]++
+			result.cipherSuites[CipherSuiteName(resp.TLS.CipherSuite)]++
+		}
+		if handshake > 0 {
+			result.handshakes.Record(handshake)
+		}
+		if failure != nil {
+			result.failures.Count++
+			result.failures.Samples = addSample(result.failures.Samples, failure.Error())
+		}
+		if result.recent != nil {
+			result.recent.Record(latency)
 		}
+		if s.tracer != nil {
+			s.tracer.record(result.phases)
+		}
+	}
+	if result.histogram == nil {
+		result.latency = append(result.latency, latency)
+	} else if err == nil {
+		result.histogram.Record(latency)
+	}
+	result.mutex.Unlock()
 
-		// Delay this thread if we need to wait between requests
-		elapsedSinceLastRequest := time.Since(start)
-		if elapsedSinceLastRequest < settings.WaitBetweenRequests {
-			time.Sleep(settings.WaitBetweenRequests - elapsedSinceLastRequest)
+	if result.timeSeries != nil || result.stages != nil {
+		end := time.Now()
+		statusCode := 0
+		if err == nil {
+			statusCode = resp.StatusCode
+		}
+		if result.timeSeries != nil {
+			result.timeSeries.record(end, latency, statusCode, err)
+		}
+		if result.stages != nil {
+			result.stages.record(end, latency, statusCode, err)
 		}
 	}
 }
+
+// checkProtocol returns an error if the response is not of the protocol required by the settings.
+func (s *sender) checkProtocol(resp *http.Response) error {
+	if (s.settings.Protocol == ProtocolHTTP2 || s.settings.Protocol == ProtocolH2C) && resp.ProtoMajor != 2 {
+		return errNotHTTP2
+	}
+	return nil
+}
+
+// readBody reads the whole response body and closes it, so that the connection can be reused.
+// The body is then replaced, with a copy in memory if keep is set, or with an empty body otherwise.
+func readBody(resp *http.Response, keep bool) (int64, error) {
+	defer resp.Body.Close()
+
+	if keep {
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return int64(len(body)), err
+	}
+
+	received, err := io.Copy(ioutil.Discard, resp.Body)
+	resp.Body = http.NoBody
+	return received, err
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type statusCodesValue struct {
+	codes *[]int
+}
+
+func (sv *statusCodesValue) String() string {
+	if sv.codes == nil {
+		return ""
+	}
+	strs := make([]string, len(*sv.codes))
+	for i, code := range *sv.codes {
+		strs[i] = strconv.Itoa(code)
+	}
+	return strings.Join(strs, ",")
+}
+
+func (sv *statusCodesValue) Set(value string) error {
+	*sv.codes = nil
+	for _, str := range strings.Split(value, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(str))
+		if err != nil || http.StatusText(code) == "" {
+			return errors.New("Bad status code argument")
+		}
+		*sv.codes = append(*sv.codes, code)
+	}
+	return nil
+}
+
+type jsonFieldsValue struct {
+	fields *map[string]string
+}
+
+func (jv *jsonFieldsValue) String() string {
+	if jv.fields == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", *jv.fields)
+}
+
+func (jv *jsonFieldsValue) Set(value string) error {
+	arr := strings.SplitN(value, "=", 2)
+	if len(arr) != 2 || arr[0] == "" {
+		return errors.New("Bad JSON field argument")
+	}
+	if *jv.fields == nil {
+		*jv.fields = make(map[string]string)
+	}
+	(*jv.fields)[arr[0]] = arr[1]
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mipnw/kurl/kurl"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+// compareMain runs kurl compare, which compares two reports saved with -save and exits with status 1
+// if the current run regressed from the baseline run.
+func compareMain(args []string) {
+	commandLine := flag.NewFlagSet("kurl compare", flag.ExitOnError)
+	commandLine.Usage = func() {
+		fmt.Fprintf(commandLine.Output(), "Kurl compare: compare the report of a current run to the report of a baseline run, saved with -save\n")
+		fmt.Fprintf(commandLine.Output(), "Usage: kurl compare [arguments] baseline.json current.json\n")
+		commandLine.PrintDefaults()
+	}
+
+	tolerances := kurl.DefaultTolerances
+	var compareOutput string
+	commandLine.Float64Var(&tolerances.Throughput, "throughput-tolerance", 100*tolerances.Throughput, "highest decrease of the rate, in percent")
+	commandLine.Float64Var(&tolerances.ErrorRate, "error-tolerance", 100*tolerances.ErrorRate, "highest increase of the error and failure rates, in percentage points")
+	commandLine.Float64Var(&tolerances.Latency, "latency-tolerance", 100*tolerances.Latency, "highest increase of the mean latency and percentiles, in percent")
+	commandLine.Float64Var(&tolerances.SignificanceLevel, "significance", tolerances.SignificanceLevel, "highest p-value of a statistically significant change")
+	commandLine.StringVar(&compareOutput, "output", "text", "output format: text, or json for a kurl.Comparison")
+	commandLine.Parse(args)
+
+	if commandLine.NArg() != 2 {
+		commandLine.Usage()
+		os.Exit(2)
+	}
+	if compareOutput != "text" && compareOutput != "json" {
+		fmt.Fprintf(os.Stderr, "-output must be text or json\n")
+		os.Exit(2)
+	}
+	tolerances.Throughput /= 100
+	tolerances.ErrorRate /= 100
+	tolerances.Latency /= 100
+
+	regressed, err := compare(commandLine.Arg(0), commandLine.Arg(1), tolerances, compareOutput)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if regressed {
+		os.Exit(1)
+	}
+}
+
+// compare prints the comparison of the reports in two files, and returns whether the current run regressed.
+func compare(baselineFile, currentFile string, tolerances kurl.Tolerances, compareOutput string) (bool, error) {
+	baseline, err := kurl.LoadReport(baselineFile)
+	if err != nil {
+		return false, err
+	}
+	current, err := kurl.LoadReport(currentFile)
+	if err != nil {
+		return false, err
+	}
+
+	comparison := kurl.Compare(baseline, current, tolerances)
+	if compareOutput == "json" {
+		if err := writeJSON(os.Stdout, comparison); err != nil {
+			return false, err
+		}
+	} else {
+		printComparison(comparison)
+	}
+	return comparison.Regressed, nil
+}
+
+// printComparison prints a table of the change of each metric, and whether it is a regression.
+func printComparison(comparison kurl.Comparison) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "metric\tbaseline\tcurrent\tchange\tp-value\tresult")
+	for _, metric := range comparison.Metrics {
+		pValue := "-"
+		if metric.Tested {
+			pValue = strconv.FormatFloat(metric.PValue, 'g', 3, 64)
+		}
+
+		result := "ok"
+		switch {
+		case metric.Regression:
+			result = "REGRESSION"
+		case metric.Improvement:
+			result = "improvement"
+		case !metric.Significant:
+			result = "not significant"
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%+.1f%%\t%s\t%s\n",
+			metric.Metric,
+			kurl.FormatMetric(metric.Metric, metric.Baseline),
+			kurl.FormatMetric(metric.Metric, metric.Current),
+			100*metric.Change,
+			pValue,
+			result)
+	}
+	writer.Flush()
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/mipnw/kurl/kurl"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -13,28 +14,88 @@ var (
 	settings       kurl.Settings
 	help           bool
 	post           bool
+	method         string
 	endpoint       string
 	headerValue    headersValue
 	bodyFilename   string
+	scenarioFile   string
+	feedFile       string
+	feedMode       string
+	assertions     kurl.Assertions
+	assertBody     string
 	printLatencies bool
+	progress       time.Duration
+	timeSeriesFile string
+	output         string
+	saveFile       string
+	protocol       string
+	stages         string
+	tlsOptions     kurl.TLSOptions
+	ciphers        string
+	percentiles    = percentilesValue{percents: []float64{50, 90, 95, 99, 99.9}}
+	thresholds     thresholdsValue
 )
 
 func usage() {
 	var CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	fmt.Fprintf(CommandLine.Output(), "Kurl: load test HTTP traffic on a specified endpoint\n")
+	fmt.Fprintf(CommandLine.Output(), "Use kurl compare [arguments] baseline.json current.json to compare two runs saved with -save\n")
+	fmt.Fprintf(CommandLine.Output(), "Use kurl search [arguments] to find the highest load which meets the -threshold arguments\n")
 	flag.PrintDefaults()
 }
 
-func parseCommandLine() {
-	flag.BoolVar(&post, "post", false, "use HTTP POST (default is GET)")
+// parseCommandLine parses the arguments of a run, without the program name.
+func parseCommandLine(args []string) {
+	flag.StringVar(&method, "method", "", "HTTP method: GET, POST, PUT, PATCH, DELETE, HEAD or OPTIONS (default GET)")
+	flag.BoolVar(&post, "post", false, "use HTTP POST, same as -method POST")
 	flag.StringVar(&endpoint, "url", "", "target endpoint")
 	flag.IntVar(&settings.ThreadCount, "thread", 10, "number of parallel threads")
 	flag.IntVar(&settings.RequestCount, "request", 10, "number of http requests per thread")
+	flag.DurationVar(&settings.Duration, "duration", 0, "how long each thread keeps issuing requests, overrides -request")
+	flag.Float64Var(&settings.Rate, "rate", 0, "requests per second regardless of response times (open model), -thread then caps concurrency")
+	flag.StringVar(&stages, "stages", "", "comma-separated duration:threads stages ramping the active threads, such as 1m:200,5m:200,30s:0, overrides -request and -duration")
 	flag.DurationVar(&settings.WaitBetweenRequests, "wait", 0, "how long to wait between requests on each thread")
 	flag.BoolVar(&help, "help", false, "print this helper")
 	flag.StringVar(&bodyFilename, "body", "", "path to file containing HTTP request body")
+	flag.StringVar(&scenarioFile, "scenario", "", "path to a YAML scenario of steps each thread sends in order, instead of -url")
+	flag.StringVar(&feedFile, "feed", "", "path to a .csv or .jsonl file of rows whose fields are used as {{.field}} in the url, headers and body")
+	flag.StringVar(&feedMode, "feed-mode", string(kurl.FeedSequential), "how threads take the rows of -feed: sequential, random or partitioned")
+	flag.StringVar(&output, "output", "text", "output format: text, or json for a kurl.Report")
+	flag.StringVar(&saveFile, "save", "", "path to a JSON file where the kurl.Report of the run is written, for kurl compare")
 	flag.BoolVar(&printLatencies, "pl", false, "print space-separated millisecond-rounded latencies to stdout")
-	flag.BoolVar(&settings.Warm, "warm", false, "Warm up with one HTTP request (not included in the result)")
+	flag.IntVar(&settings.HistogramPrecision, "hdr", 0, "significant digits (1-5) of an HDR histogram recording latencies in constant memory")
+	flag.DurationVar(&settings.HistogramMax, "hdr-max", kurl.DefaultHistogramMax, "highest latency tracked by the -hdr histogram")
+	flag.Var(&percentiles, "percentiles", "comma-separated latency percentiles to print")
+	flag.DurationVar(&progress, "progress", 0, "print a status line to stderr at this interval during the run")
+	flag.DurationVar(&settings.Interval, "interval", time.Second, "width of the intervals of the -timeseries output")
+	flag.StringVar(&timeSeriesFile, "timeseries", "", "path to a CSV file where per-interval throughput, latencies and status codes are written")
+	flag.BoolVar(&settings.TracePhases, "trace", false, "time the dns, connect, tls, send and wait phases of every request")
+	flag.BoolVar(&settings.KeepBody, "keep-body", false, "keep response bodies in memory instead of discarding them as they are read")
+	flag.BoolVar(&settings.Warm, "warm", false, "Warm up with one HTTP request per thread (not included in the result)")
+	flag.IntVar(&settings.WarmCount, "warm-count", 0, "number of HTTP requests per thread to warm up with (not included in the result)")
+	flag.DurationVar(&settings.WarmDuration, "warm-duration", 0, "how long each thread warms up with HTTP requests (not included in the result), overrides -warm-count")
+
+	flag.Var(&statusCodesValue{codes: &assertions.Status}, "assert-status", "comma-separated status codes which every response must have")
+	flag.StringVar(&assertBody, "assert-body", "", "text which every response body must contain")
+	flag.Var(&jsonFieldsValue{fields: &assertions.JSON}, "assert-json", "a field every JSON response body must have, in the form path=value, such as data.items.0.id=7")
+	flag.DurationVar(&assertions.MaxLatency, "assert-latency", 0, "highest latency of every response")
+	flag.Var(&thresholds, "threshold", "comma-separated conditions on the result such as p99<300ms, error_rate<1% or rate>500, exits with status 1 if one fails (repeatable)")
+
+	flag.BoolVar(&settings.DisableKeepAlives, "no-keepalive", false, "open a new connection for every request")
+	flag.IntVar(&settings.MaxConnsPerHost, "max-conns", 0, "cap on the connections of each transport to the host, unlimited when 0")
+	flag.IntVar(&settings.MaxIdleConnsPerHost, "max-idle-conns", 0, "idle connections each transport keeps to the host, one per thread using it when 0")
+	flag.DurationVar(&settings.IdleConnTimeout, "idle-timeout", 0, "how long an idle connection is kept open (default 1m30s)")
+	flag.StringVar(&protocol, "protocol", "", "force http1, http2 over TLS with https URLs, or h2c (HTTP/2 over cleartext) with http URLs, instead of negotiating the protocol")
+	flag.BoolVar(&settings.SharedTransport, "shared-transport", false, "share one transport and its connections between threads, instead of one transport per thread")
+
+	flag.StringVar(&tlsOptions.CACertFile, "cacert", "", "path to a PEM bundle of the certificate authorities to trust instead of the system ones")
+	flag.StringVar(&tlsOptions.CertFile, "cert", "", "path to a PEM client certificate for mutual TLS, with -key")
+	flag.StringVar(&tlsOptions.KeyFile, "key", "", "path to the PEM private key of -cert")
+	flag.BoolVar(&tlsOptions.Insecure, "insecure", false, "skip the verification of the server certificate")
+	flag.StringVar(&tlsOptions.ServerName, "servername", "", "server name sent with SNI and verified in the server certificate, instead of the host of -url")
+	flag.StringVar(&tlsOptions.MinVersion, "tls-min", "", "lowest TLS version: 1.0, 1.1, 1.2 or 1.3")
+	flag.StringVar(&tlsOptions.MaxVersion, "tls-max", "", "highest TLS version: 1.0, 1.1, 1.2 or 1.3")
+	flag.StringVar(&ciphers, "ciphers", "", "comma-separated TLS 1.0-1.2 cipher suites, such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
 
 	var defaultTimeout time.Duration
 	flag.DurationVar(&settings.Timeout, "timeout", defaultTimeout, "http client timeout")
@@ -42,5 +103,19 @@ func parseCommandLine() {
 	headerValue.header = make(http.Header)
 	flag.Var(&headerValue, "h", "an HTTP header in the form key=value")
 
-	flag.Parse()
+	flag.CommandLine.Parse(args)
+
+	method = strings.ToUpper(method)
+	settings.Protocol = kurl.Protocol(protocol)
+	if ciphers != "" {
+		tlsOptions.CipherSuites = strings.Split(ciphers, ",")
+	}
+	if assertBody != "" {
+		assertions.BodyContains = []string{assertBody}
+	}
+
+	// Only record a time series when we need one
+	if timeSeriesFile == "" {
+		settings.Interval = 0
+	}
 }
@@ -1,22 +1,49 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/mipnw/kurl/kurl"
-	"math"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 )
 
 func validateCommandLine() bool {
+	if scenarioFile != "" {
+		return validateScenarioCommandLine() && validateOutputCommandLine()
+	}
 	_, err := url.ParseRequestURI(endpoint)
-	if err != nil {
+	if err != nil && !(feedFile != "" && strings.Contains(endpoint, "{{")) {
 		fmt.Printf("-url argument is required and must be a valid URL\n\n")
 		return false
 	}
+	if post {
+		if method != "" && method != "POST" {
+			fmt.Printf("-post cannot be used with -method %s\n\n", method)
+			return false
+		}
+		method = "POST"
+	}
+	if method == "" {
+		method = "GET"
+	}
+	if !isSupportedMethod(method) {
+		fmt.Printf("-method must be one of %s\n\n", strings.Join(supportedMethods, ", "))
+		return false
+	}
+	if bodyFilename != "" && (method == "GET" || method == "HEAD") {
+		fmt.Printf("-body cannot be used with -method %s\n\n", method)
+		return false
+	}
 	if bodyFilename != "" {
 		info, err := os.Stat(bodyFilename)
 		if os.IsNotExist(err) || info.IsDir() {
@@ -24,17 +51,110 @@ func validateCommandLine() bool {
 			return false
 		}
 	}
+	return validateOutputCommandLine()
+}
+
+// validateScenarioCommandLine checks the arguments of a run of a scenario, which describes its own requests.
+func validateScenarioCommandLine() bool {
+	if endpoint != "" || method != "" || post || bodyFilename != "" || len(headerValue.header) > 0 {
+		fmt.Printf("-scenario cannot be used with -url, -method, -post, -body or -h\n\n")
+		return false
+	}
+	if asserts() {
+		fmt.Printf("-scenario cannot be used with -assert arguments, the steps of the scenario have their own assertions\n\n")
+		return false
+	}
+	info, err := os.Stat(scenarioFile)
+	if os.IsNotExist(err) || info.IsDir() {
+		fmt.Printf("file %s does not exist\n\n", scenarioFile)
+		return false
+	}
 	return true
 }
 
-func makeHTTPRequest() (*http.Request, error) {
-	var method string
+// validateOutputCommandLine checks the arguments controlling what is recorded and printed, and the feed.
+func validateOutputCommandLine() bool {
+	if feedFile != "" {
+		info, err := os.Stat(feedFile)
+		if os.IsNotExist(err) || info.IsDir() {
+			fmt.Printf("file %s does not exist\n\n", feedFile)
+			return false
+		}
+	}
+	switch settings.Protocol {
+	case kurl.ProtocolAuto, kurl.ProtocolHTTP1, kurl.ProtocolHTTP2, kurl.ProtocolH2C:
+	default:
+		fmt.Printf("-protocol must be http1, http2 or h2c\n\n")
+		return false
+	}
+	if stages != "" {
+		var err error
+		if settings.Stages, err = kurl.ParseStages(stages); err != nil {
+			fmt.Printf("%s\n\n", err.Error())
+			return false
+		}
+		if settings.Rate > 0 {
+			fmt.Printf("-stages cannot be used with -rate\n\n")
+			return false
+		}
+		// Start enough threads for the busiest stage
+		if max := kurl.MaxTarget(settings.Stages); max > settings.ThreadCount {
+			settings.ThreadCount = max
+		}
+	}
+	if settings.MaxConnsPerHost < 0 || settings.MaxIdleConnsPerHost < 0 || settings.IdleConnTimeout < 0 {
+		fmt.Printf("-max-conns, -max-idle-conns and -idle-timeout cannot be negative\n\n")
+		return false
+	}
+	switch kurl.FeedMode(feedMode) {
+	case kurl.FeedSequential, kurl.FeedRandom, kurl.FeedPartitioned:
+	default:
+		fmt.Printf("-feed-mode must be sequential, random or partitioned\n\n")
+		return false
+	}
+	if timeSeriesFile != "" && settings.Interval <= 0 {
+		fmt.Printf("-interval must be positive\n\n")
+		return false
+	}
+	if output != "text" && output != "json" {
+		fmt.Printf("-output must be text or json\n\n")
+		return false
+	}
+	if printLatencies && output == "json" {
+		fmt.Printf("-pl cannot be used with -output json\n\n")
+		return false
+	}
+	if printLatencies && settings.HistogramPrecision != 0 {
+		fmt.Printf("-pl cannot be used with -hdr, which does not keep every latency\n\n")
+		return false
+	}
+	return true
+}
 
-	if post {
-		method = "POST"
-	} else {
-		method = "GET"
+var supportedMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+
+// asserts returns whether the command line has assertions on the responses.
+func asserts() bool {
+	return len(assertions.Status) > 0 || assertions.ReadsBody() || assertions.MaxLatency > 0
+}
+
+// configuresTLS returns whether the command line has TLS arguments.
+func configuresTLS() bool {
+	return tlsOptions.CACertFile != "" || tlsOptions.CertFile != "" || tlsOptions.KeyFile != "" ||
+		tlsOptions.Insecure || tlsOptions.ServerName != "" || tlsOptions.MinVersion != "" ||
+		tlsOptions.MaxVersion != "" || len(tlsOptions.CipherSuites) > 0
+}
+
+func isSupportedMethod(method string) bool {
+	for _, supported := range supportedMethods {
+		if method == supported {
+			return true
+		}
 	}
+	return false
+}
+
+func makeHTTPRequest() (*http.Request, error) {
 	req, err := http.NewRequest(method, endpoint, nil)
 	if err != nil {
 		return nil, err
@@ -43,40 +163,87 @@ func makeHTTPRequest() (*http.Request, error) {
 	req.Header = headerValue.header
 
 	if bodyFilename != "" {
-		file, err := os.Open(bodyFilename)
+		body, err := ioutil.ReadFile(bodyFilename)
 		if err != nil {
 			return nil, err
 		}
-		req.Body = file
+		kurl.SetBody(req, body)
 	}
 	return req, nil
 }
 
 func main() {
-	parseCommandLine()
+	if len(os.Args) > 1 && os.Args[1] == "compare" {
+		compareMain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "search" {
+		searchMain(os.Args[2:])
+		return
+	}
+
+	parseCommandLine(os.Args[1:])
 	if help || !validateCommandLine() {
 		usage()
 		return
 	}
 
-	request, err := makeHTTPRequest()
+	request, scenario, err := prepare()
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
 	}
 
-	result, err := kurl.Do(settings, *request)
+	if progress > 0 {
+		settings.Progress = printProgress
+		settings.ProgressInterval = progress
+	}
+
+	result, err := runLoad(interruptibleContext(), settings, request, scenario)
+	if progress > 0 {
+		// Erase the status line
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 
+	if result.Interrupted {
+		fmt.Fprintln(os.Stderr, "interrupted: statistics only cover the requests issued so far")
+	}
+
+	if timeSeriesFile != "" {
+		if err := saveTimeSeries(result); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
+
 	// Error count to stderr
 	if result.ErrorCount != 0 {
 		fmt.Fprintf(os.Stderr, "http errors: %d\n", result.ErrorCount)
 	}
+	if result.Failures.Count != 0 {
+		fmt.Fprintf(os.Stderr, "failed assertions: %d\n", result.Failures.Count)
+	}
+
+	evaluations, passed := kurl.EvaluateThresholds(thresholds.thresholds, result)
+	report := makeReport(scenario, result, evaluations)
+	if saveFile != "" {
+		if err := saveReport(report); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	}
 
 	// Formatted output to stdout
-	if printLatencies {
+	if output == "json" {
+		if err := writeJSON(os.Stdout, report); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	} else if printLatencies {
 		// space-separated, millisecond rounted latencies to stdout, for easy loading in your favorite math IDE
 		outputStr := ""
 		for i := 0; i < len(result.Latencies); i++ {
@@ -84,66 +251,447 @@ func main() {
 		}
 		outputStr = strings.TrimRight(outputStr, " ")
 		fmt.Println(outputStr)
+		printThresholds(os.Stderr, evaluations)
 	} else {
 		// Default formatted output
-		fmt.Printf("completed: %d %.0fHz\n", result.CompletedCount, float64(result.CompletedCount)/result.OverallDuration.Seconds())
+		fmt.Printf("completed: %d %.0fHz\n", result.CompletedCount, completedRate(result))
 
 		if result.CompletedCount > 0 {
 			for statusCode, freq := range result.StatusCodesFrequency {
 				fmt.Printf("http %d (%s): %d %d%% %.0fHz\n",
 					statusCode, http.StatusText(statusCode),
 					freq,
-					int(100*float32(freq)/float32(result.CompletedCount)),                      // percentage
-					float64(result.StatusCodesFrequency[200])/result.OverallDuration.Seconds()) // rate in Hz
+					int(100*float32(freq)/float32(result.CompletedCount)), // percentage
+					float64(freq)/result.OverallDuration.Seconds())        // rate in Hz
 			}
 		}
 
+		printErrors(result)
+		printFailures(result)
+
 		fmt.Printf("duration: %v\n", result.OverallDuration.Round(time.Millisecond))
+		printBytes(result)
+		printConnections(result)
+		printTLS(result)
 		printLatencyStats(result)
+		printPhases(result)
+		if scenarioFile != "" {
+			printSteps(result)
+		}
+		printStages(result)
+		printThresholds(os.Stdout, evaluations)
+	}
+
+	if !passed {
+		os.Exit(1)
+	}
+}
+
+// prepare returns the request or the scenario of the run described by the command line, with its feed,
+// assertions and TLS configuration.
+func prepare() (*http.Request, *kurl.Scenario, error) {
+	var request *http.Request
+	var scenario *kurl.Scenario
+	var err error
+	if scenarioFile != "" {
+		scenario, err = readScenario()
+	} else if feedFile != "" {
+		scenario, err = makeScenario()
+	} else {
+		request, err = makeHTTPRequest()
+	}
+	if err == nil && feedFile != "" {
+		scenario.Feeder, err = kurl.LoadFeeder(feedFile, kurl.FeedMode(feedMode))
+	}
+	if err == nil && configuresTLS() {
+		settings.TLSConfig, err = kurl.LoadTLSConfig(tlsOptions)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if asserts() {
+		if scenario != nil {
+			scenario.Steps[0].Assert = &assertions
+		} else {
+			settings.KeepBody = settings.KeepBody || assertions.ReadsBody()
+		}
+	}
+	return request, scenario, nil
+}
+
+// runLoad runs the request or the scenario with the given settings.
+func runLoad(ctx context.Context, runSettings kurl.Settings, request *http.Request, scenario *kurl.Scenario) (*kurl.Result, error) {
+	if scenario != nil {
+		return kurl.DoScenarioContext(ctx, runSettings, *scenario)
+	}
+	if asserts() {
+		requests := make([]*http.Request, runSettings.ThreadCount)
+		tests := make([]kurl.Test, runSettings.ThreadCount)
+		for i := range requests {
+			requests[i] = request
+			tests[i] = assertions.Test()
+		}
+		return kurl.DoManyTestContext(ctx, runSettings, requests, tests)
 	}
+	return kurl.DoContext(ctx, runSettings, *request)
+}
+
+func readScenario() (*kurl.Scenario, error) {
+	data, err := ioutil.ReadFile(scenarioFile)
+	if err != nil {
+		return nil, err
+	}
+	return kurl.ParseScenario(data)
+}
+
+// makeScenario returns a scenario of the one request described by the command line,
+// whose url, headers and body are templates of the fields of the feed.
+func makeScenario() (*kurl.Scenario, error) {
+	step := kurl.Step{
+		Method:  method,
+		URL:     endpoint,
+		Headers: make(map[string]string),
+	}
+	for key := range headerValue.header {
+		step.Headers[key] = headerValue.header.Get(key)
+	}
+	if bodyFilename != "" {
+		body, err := ioutil.ReadFile(bodyFilename)
+		if err != nil {
+			return nil, err
+		}
+		step.Body = string(body)
+	}
+	return &kurl.Scenario{Steps: []kurl.Step{step}}, nil
+}
+
+// makeReport returns the kurl.Report of the run of a request or of a scenario, with its thresholds.
+func makeReport(scenario *kurl.Scenario, result *kurl.Result, evaluations []kurl.ThresholdResult) kurl.Report {
+	report := kurl.NewReport(settings, result, percentiles.percents)
+	report.AddThresholds(evaluations)
+	if scenarioFile != "" {
+		report.Settings.Scenario = scenario.Name
+	} else {
+		report.Settings.Method = method
+		report.Settings.URL = endpoint
+	}
+	return report
+}
+
+// saveReport writes the report of the run to the -save file, for a later kurl compare.
+func saveReport(report kurl.Report) error {
+	file, err := os.Create(saveFile)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(file, report); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(v)
+}
+
+func saveTimeSeries(result *kurl.Result) error {
+	file, err := os.Create(timeSeriesFile)
+	if err != nil {
+		return err
+	}
+	if err := writeTimeSeries(file, result.Intervals); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// interruptibleContext returns a context which is cancelled on the first SIGINT.
+// A second SIGINT terminates the process.
+func interruptibleContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		signal.Stop(interrupt)
+		cancel()
+	}()
+	return ctx
+}
+
+// printProgress overwrites the status line on stderr with a progress snapshot.
+func printProgress(progress kurl.Progress) {
+	statusCodes := make([]int, 0, len(progress.StatusCodesFrequency))
+	for statusCode := range progress.StatusCodesFrequency {
+		statusCodes = append(statusCodes, statusCode)
+	}
+	sort.Ints(statusCodes)
+
+	line := fmt.Sprintf("%v completed: %d errors: %d %.0fHz p50: %v p99: %v",
+		progress.Elapsed.Round(time.Second),
+		progress.CompletedCount,
+		progress.ErrorCount,
+		progress.Rate,
+		progress.Recent.Percentile(0.5).Round(time.Millisecond),
+		progress.Recent.Percentile(0.99).Round(time.Millisecond))
+	for _, statusCode := range statusCodes {
+		line += fmt.Sprintf(" http %d: %d", statusCode, progress.StatusCodesFrequency[statusCode])
+	}
+	fmt.Fprint(os.Stderr, "\r\033[K"+line)
+}
+
+// printErrors prints the count of each category of errors, with a sample error message.
+func printErrors(result *kurl.Result) {
+	categories := make([]string, 0, len(result.Errors))
+	for category := range result.Errors {
+		categories = append(categories, string(category))
+	}
+	sort.Strings(categories)
+
+	total := result.CompletedCount + result.ErrorCount
+	for _, category := range categories {
+		summary := result.Errors[kurl.ErrorCategory(category)]
+		fmt.Printf("error %s: %d %d%% (%s)\n",
+			category,
+			summary.Count,
+			int(100*float32(summary.Count)/float32(total)),
+			summary.Samples[0])
+	}
+}
+
+// printFailures prints the count of responses which failed their assertions, with a sample failure.
+func printFailures(result *kurl.Result) {
+	if result.Failures.Count == 0 {
+		return
+	}
+	fmt.Printf("failed: %d %d%% (%s)\n",
+		result.Failures.Count,
+		int(100*float32(result.Failures.Count)/float32(result.CompletedCount)),
+		result.Failures.Samples[0])
 }
 
 func printLatencyStats(result *kurl.Result) {
-	minLatency := result.Latencies[0]
-	var avgLatency time.Duration
-	maxLatency := result.Latencies[0]
+	if result.CompletedCount == 0 {
+		return
+	}
+
+	stats := result.LatencyStats()
+	fmt.Printf("latency  min: %v, avg: %v, max: %v (std:%v)\n",
+		stats.Min.Round(time.Millisecond),
+		stats.Mean.Round(time.Millisecond),
+		stats.Max.Round(time.Millisecond),
+		stats.StdDev.Round(time.Millisecond))
+	printPercentiles(result)
+
+	ttfb := result.TimeToFirstByte.LatencyStats()
+	fmt.Printf("ttfb     min: %v, avg: %v, max: %v (std:%v)\n",
+		ttfb.Min.Round(time.Millisecond),
+		ttfb.Mean.Round(time.Millisecond),
+		ttfb.Max.Round(time.Millisecond),
+		ttfb.StdDev.Round(time.Millisecond))
+}
 
-	completed := 0
-	for i := 0; i < len(result.Latencies); i++ {
-		// Skip the flagged latencies which correspond to HTTP errors
-		if result.Latencies[i] == 0 {
-			continue
+// completedRate returns the completed requests per second of a run, 0 when it was interrupted during the warm-up.
+func completedRate(result *kurl.Result) float64 {
+	if result.OverallDuration <= 0 {
+		return 0
+	}
+	return float64(result.CompletedCount) / result.OverallDuration.Seconds()
+}
+
+// printBytes prints the body bytes received and sent, per request and per second.
+func printBytes(result *kurl.Result) {
+	if result.CompletedCount == 0 {
+		return
+	}
+	fmt.Printf("received: %d bytes (%d bytes/request) %.2fMB/s\n",
+		result.BytesReceived,
+		result.BytesReceived/int64(result.CompletedCount),
+		float64(result.BytesReceived)/result.OverallDuration.Seconds()/1e6)
+	if result.BytesSent > 0 {
+		fmt.Printf("sent: %d bytes (%d bytes/request) %.2fMB/s\n",
+			result.BytesSent,
+			result.BytesSent/int64(result.CompletedCount),
+			float64(result.BytesSent)/result.OverallDuration.Seconds()/1e6)
+	}
+}
+
+// printConnections prints the share of each protocol and of requests sent on a reused connection.
+func printConnections(result *kurl.Result) {
+	if result.CompletedCount == 0 {
+		return
+	}
+	fmt.Printf("protocol: %s, connections reused: %d%%\n", shares(result.Protocols, result.CompletedCount), int(100*result.ConnectionReuseRatio()))
+}
+
+// printTLS prints the share of each TLS version and cipher suite, and the durations of the TLS handshakes.
+func printTLS(result *kurl.Result) {
+	if len(result.TLSVersions) == 0 {
+		return
+	}
+	fmt.Printf("tls: %s, %s\n", shares(result.TLSVersions, result.CompletedCount), shares(result.CipherSuites, result.CompletedCount))
+
+	handshakes := result.TLSHandshakes
+	if handshakes.Count() == 0 {
+		return
+	}
+	stats := handshakes.LatencyStats()
+	fmt.Printf("tls handshake  count: %d, min: %v, avg: %v, max: %v (std:%v)\n",
+		handshakes.Count(),
+		stats.Min.Round(time.Microsecond),
+		stats.Mean.Round(time.Microsecond),
+		stats.Max.Round(time.Microsecond),
+		stats.StdDev.Round(time.Microsecond))
+}
+
+// shares formats the percentage of the total of each key of counts, such as "HTTP/1.1 90%, HTTP/2.0 10%".
+func shares(counts map[string]int, total int) string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	strs := make([]string, len(keys))
+	for i, key := range keys {
+		strs[i] = fmt.Sprintf("%s %d%%", key, int(100*float32(counts[key])/float32(total)))
+	}
+	return strings.Join(strs, ", ")
+}
+
+// printPhases prints a table of the durations of the phases of requests, if they were traced.
+func printPhases(result *kurl.Result) {
+	if result.Phases == nil {
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "phase\tcount\tmin\tavg\tmax"
+	for _, percent := range percentiles.percents {
+		header += "\t" + kurl.PercentileName(percent)
+	}
+	fmt.Fprintln(writer, header)
+
+	for _, phase := range kurl.Phases {
+		histogram := result.Phases[phase]
+		stats := histogram.LatencyStats()
+		row := fmt.Sprintf("%s\t%d\t%v\t%v\t%v",
+			phase,
+			histogram.Count(),
+			stats.Min.Round(time.Microsecond),
+			stats.Mean.Round(time.Microsecond),
+			stats.Max.Round(time.Microsecond))
+		for _, percent := range percentiles.percents {
+			row += fmt.Sprintf("\t%v", histogram.Percentile(percent/100).Round(time.Microsecond))
 		}
+		fmt.Fprintln(writer, row)
+	}
+	writer.Flush()
+}
 
-		completed++
-		avgLatency += result.Latencies[i]
-		if result.Latencies[i] < minLatency {
-			minLatency = result.Latencies[i]
-		} else if result.Latencies[i] > maxLatency {
-			maxLatency = result.Latencies[i]
+// printSteps prints a table of the statistics of each step, if a scenario was run.
+func printSteps(result *kurl.Result) {
+	if result.Steps == nil {
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "step\tcompleted\terrors\trate\tmin\tavg\tmax"
+	for _, percent := range percentiles.percents {
+		header += "\t" + kurl.PercentileName(percent)
+	}
+	fmt.Fprintln(writer, header)
+
+	for i := range result.Steps {
+		step := &result.Steps[i]
+		stats := step.LatencyStats()
+		row := fmt.Sprintf("%s\t%d\t%d\t%.0fHz\t%v\t%v\t%v",
+			step.Name,
+			step.CompletedCount,
+			step.ErrorCount,
+			completedRate(&step.Result),
+			stats.Min.Round(time.Millisecond),
+			stats.Mean.Round(time.Millisecond),
+			stats.Max.Round(time.Millisecond))
+		for _, percent := range percentiles.percents {
+			row += fmt.Sprintf("\t%v", step.Percentile(percent/100).Round(time.Millisecond))
 		}
+		fmt.Fprintln(writer, row)
 	}
-	avgLatency = time.Duration(float64(avgLatency.Milliseconds())/float64(completed)) * time.Millisecond
-	if completed != result.CompletedCount {
-		panic("Kurl has a bug in the handling of latency statistics when there are HTTP errors")
+	writer.Flush()
+}
+
+// printStages prints a table of the statistics of each stage, if a load profile was run.
+func printStages(result *kurl.Result) {
+	if result.Stages == nil {
+		return
 	}
 
-	var stdLatency time.Duration
-	if result.CompletedCount > 1 {
-		var agg int64
-		for i := 0; i < result.CompletedCount; i++ {
-			d := result.Latencies[i] - avgLatency
-			agg += (d.Microseconds() * d.Microseconds())
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "stage\tstart\tthreads\tcompleted\terrors\trate\tmin\tavg\tmax"
+	for _, percent := range percentiles.percents {
+		header += "\t" + kurl.PercentileName(percent)
+	}
+	fmt.Fprintln(writer, header)
+
+	for i := range result.Stages {
+		stage := &result.Stages[i]
+		stats := stage.Histogram.LatencyStats()
+		row := fmt.Sprintf("%d\t%v\t%d->%d\t%d\t%d\t%.0fHz\t%v\t%v\t%v",
+			i+1,
+			stage.Start,
+			stage.From,
+			stage.Target,
+			stage.CompletedCount,
+			stage.ErrorCount,
+			float64(stage.CompletedCount)/stage.Duration.Seconds(),
+			stats.Min.Round(time.Millisecond),
+			stats.Mean.Round(time.Millisecond),
+			stats.Max.Round(time.Millisecond))
+		for _, percent := range percentiles.percents {
+			row += fmt.Sprintf("\t%v", stage.Histogram.Percentile(percent/100).Round(time.Millisecond))
+		}
+		fmt.Fprintln(writer, row)
+	}
+	writer.Flush()
+}
+
+// printThresholds prints a table of whether each threshold passed, if there are any.
+func printThresholds(w io.Writer, evaluations []kurl.ThresholdResult) {
+	if len(evaluations) == 0 {
+		return
+	}
+
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "threshold\tactual\tresult")
+	for _, evaluation := range evaluations {
+		status := "pass"
+		if !evaluation.Passed {
+			status = "FAIL"
 		}
-		avg := float64(agg) / float64(result.CompletedCount-1)
-		stdLatency = time.Duration(math.Sqrt(avg)) * time.Microsecond
+		fmt.Fprintf(writer, "%s\t%s\t%s\n",
+			evaluation.Expression,
+			evaluation.Format(evaluation.Actual),
+			status)
 	}
+	writer.Flush()
+}
 
-	if result.CompletedCount > 0 {
-		fmt.Printf("latency  min: %v, avg: %v, max: %v (std:%v)\n",
-			minLatency.Round(time.Millisecond),
-			avgLatency.Round(time.Millisecond),
-			maxLatency.Round(time.Millisecond),
-			stdLatency.Round(time.Millisecond))
+func printPercentiles(result *kurl.Result) {
+	if len(percentiles.percents) == 0 {
+		return
+	}
+	strs := make([]string, len(percentiles.percents))
+	for i, percent := range percentiles.percents {
+		strs[i] = fmt.Sprintf("%s: %v",
+			kurl.PercentileName(percent),
+			result.Percentile(percent/100).Round(time.Millisecond))
 	}
+	fmt.Printf("latency  %s\n", strings.Join(strs, ", "))
 }
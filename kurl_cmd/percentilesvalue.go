@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+type percentilesValue struct {
+	percents []float64
+}
+
+func (pv *percentilesValue) String() string {
+	strs := make([]string, len(pv.percents))
+	for i, percent := range pv.percents {
+		strs[i] = strconv.FormatFloat(percent, 'f', -1, 64)
+	}
+	return strings.Join(strs, ",")
+}
+
+func (pv *percentilesValue) Set(value string) error {
+	pv.percents = nil
+	if value == "" {
+		return nil
+	}
+	for _, str := range strings.Split(value, ",") {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return errors.New("Bad percentile argument")
+		}
+		pv.percents = append(pv.percents, percent)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/mipnw/kurl/kurl"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	search     kurl.SearchSettings
+	searchLoad string
+	searchMode string
+)
+
+// searchUsage prints the usage of kurl search, whose arguments are those of a run and those of the search.
+func searchUsage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Kurl search: find the highest load which meets the -threshold arguments, with runs of increasing load\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: kurl search -start [load] -max [load] -threshold [condition] [arguments]\n")
+	flag.PrintDefaults()
+}
+
+// searchMain runs kurl search, which increases the threads or the rate of runs of the request or scenario
+// of the command line until a threshold fails, and prints the knee and a table of the runs.
+func searchMain(args []string) {
+	flag.StringVar(&searchLoad, "load", string(kurl.SearchThreads), "load to increase: threads, or rate for the open model with -thread capping concurrency")
+	flag.StringVar(&searchMode, "mode", string(kurl.SearchLinear), "linear to increase the load by -step until a threshold fails, or binary to bisect between -start and -max")
+	flag.Float64Var(&search.Start, "start", 0, "load of the first run, in threads or Hz")
+	flag.Float64Var(&search.Max, "max", 0, "highest load to run, in threads or Hz")
+	flag.Float64Var(&search.Step, "step", 0, "increase of the load between runs of a linear search (default -start)")
+	flag.Float64Var(&search.Precision, "precision", 1, "a binary search stops when the passing and failing loads are this close")
+	flag.DurationVar(&search.Pause, "pause", 0, "how long to wait between runs, to let the service recover")
+
+	parseCommandLine(args)
+	if help || !validateCommandLine() || !validateSearchCommandLine() {
+		searchUsage()
+		return
+	}
+
+	request, scenario, err := prepare()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	if progress > 0 {
+		settings.Progress = printProgress
+		settings.ProgressInterval = progress
+	}
+	search.Progress = printSearchStep
+	search.Thresholds = thresholds.thresholds
+
+	run := func(ctx context.Context, runSettings kurl.Settings) (*kurl.Result, error) {
+		return runLoad(ctx, runSettings, request, scenario)
+	}
+	result, err := kurl.Search(interruptibleContext(), settings, search, run)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	if result.Interrupted {
+		fmt.Fprintln(os.Stderr, "interrupted: the search only covers the runs completed so far")
+	}
+
+	if output == "json" {
+		report := kurl.NewSearchReport(settings, search, result, percentiles.percents)
+		for i := range report.Steps {
+			if scenarioFile != "" {
+				report.Steps[i].Report.Settings.Scenario = scenario.Name
+			} else {
+				report.Steps[i].Report.Settings.Method = method
+				report.Steps[i].Report.Settings.URL = endpoint
+			}
+		}
+		if err := writeJSON(os.Stdout, report); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+	} else {
+		printSearch(result)
+	}
+
+	if result.Knee() == nil {
+		os.Exit(1)
+	}
+}
+
+// validateSearchCommandLine checks the arguments of the search, after those of the run.
+func validateSearchCommandLine() bool {
+	search.Load = kurl.SearchLoad(searchLoad)
+	search.Mode = kurl.SearchMode(searchMode)
+	if search.Step == 0 {
+		search.Step = search.Start
+	}
+	switch search.Load {
+	case kurl.SearchThreads, kurl.SearchRate:
+	default:
+		fmt.Printf("-load must be threads or rate\n\n")
+		return false
+	}
+	switch search.Mode {
+	case kurl.SearchLinear, kurl.SearchBinary:
+	default:
+		fmt.Printf("-mode must be linear or binary\n\n")
+		return false
+	}
+	if search.Start <= 0 || search.Max < search.Start {
+		fmt.Printf("-start must be positive, and -max at least -start\n\n")
+		return false
+	}
+	if len(thresholds.thresholds) == 0 {
+		fmt.Printf("kurl search requires at least one -threshold\n\n")
+		return false
+	}
+	if stages != "" || saveFile != "" || timeSeriesFile != "" || printLatencies {
+		fmt.Printf("kurl search cannot be used with -stages, -save, -timeseries or -pl\n\n")
+		return false
+	}
+	return true
+}
+
+// formatLoad formats a load of the search, such as 200 threads or 500Hz.
+func formatLoad(load float64) string {
+	if search.Load == kurl.SearchRate {
+		return strconv.FormatFloat(load, 'f', -1, 64) + "Hz"
+	}
+	if load == 1 {
+		return "1 thread"
+	}
+	return strconv.FormatFloat(load, 'f', -1, 64) + " threads"
+}
+
+// printSearchStep prints one line to stderr about a run of the search, as it completes.
+func printSearchStep(step kurl.SearchStep) {
+	if progress > 0 {
+		// Erase the status line
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	status := "pass"
+	if !step.Passed {
+		status = "FAIL"
+	}
+	fmt.Fprintf(os.Stderr, "%s: %.0fHz %s\n", formatLoad(step.Load), completedRate(step.Result), status)
+}
+
+// printSearch prints a table of the runs of the search by increasing load, and the knee.
+func printSearch(result *kurl.SearchResult) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "load\tcompleted\terrors\trate\tavg"
+	for _, percent := range percentiles.percents {
+		header += "\t" + kurl.PercentileName(percent)
+	}
+	fmt.Fprintln(writer, header+"\tresult")
+
+	for _, step := range result.SortedSteps() {
+		run := step.Result
+		row := fmt.Sprintf("%s\t%d\t%d\t%.0fHz\t%v",
+			formatLoad(step.Load),
+			run.CompletedCount,
+			run.ErrorCount,
+			completedRate(run),
+			run.LatencyStats().Mean.Round(time.Millisecond))
+		for _, percent := range percentiles.percents {
+			row += fmt.Sprintf("\t%v", run.Percentile(percent/100).Round(time.Millisecond))
+		}
+		status := "pass"
+		if run.Interrupted {
+			status = "interrupted"
+		} else if !step.Passed {
+			status = "FAIL"
+			for _, evaluation := range step.Thresholds {
+				if !evaluation.Passed {
+					status += " " + evaluation.Expression
+				}
+			}
+		}
+		fmt.Fprintln(writer, row+"\t"+status)
+	}
+	writer.Flush()
+
+	knee := result.Knee()
+	switch {
+	case knee == nil && result.Interrupted:
+		fmt.Println("knee: none found before the interruption")
+	case knee == nil:
+		fmt.Println("knee: none, the lowest load failed the thresholds")
+	case result.ReachedMax:
+		fmt.Printf("knee: beyond %s, the highest load searched\n", formatLoad(knee.Load))
+	default:
+		actuals := make([]string, len(knee.Thresholds))
+		for i, evaluation := range knee.Thresholds {
+			actuals[i] = evaluation.Metric + " " + evaluation.Format(evaluation.Actual)
+		}
+		fmt.Printf("knee: %s, %.0fHz, %s\n",
+			formatLoad(knee.Load),
+			completedRate(knee.Result),
+			strings.Join(actuals, ", "))
+	}
+}
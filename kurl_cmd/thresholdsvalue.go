@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/mipnw/kurl/kurl"
+	"strings"
+)
+
+type thresholdsValue struct {
+	thresholds []kurl.Threshold
+}
+
+func (tv *thresholdsValue) String() string {
+	strs := make([]string, len(tv.thresholds))
+	for i, threshold := range tv.thresholds {
+		strs[i] = threshold.Expression
+	}
+	return strings.Join(strs, ",")
+}
+
+func (tv *thresholdsValue) Set(value string) error {
+	for _, str := range strings.Split(value, ",") {
+		threshold, err := kurl.ParseThreshold(str)
+		if err != nil {
+			return err
+		}
+		tv.thresholds = append(tv.thresholds, threshold)
+	}
+	return nil
+}
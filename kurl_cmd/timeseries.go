@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/mipnw/kurl/kurl"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// writeTimeSeries writes one CSV row per interval of the run, with the interval's throughput,
+// latency percentiles and status codes frequencies.
+func writeTimeSeries(w io.Writer, intervals []kurl.Interval) error {
+	// Every status code seen during the run gets a column
+	seen := make(map[int]bool)
+	for _, interval := range intervals {
+		for statusCode := range interval.StatusCodesFrequency {
+			seen[statusCode] = true
+		}
+	}
+	statusCodes := make([]int, 0, len(seen))
+	for statusCode := range seen {
+		statusCodes = append(statusCodes, statusCode)
+	}
+	sort.Ints(statusCodes)
+
+	header := []string{"start_s", "completed", "errors", "rate_hz"}
+	for _, percent := range percentiles.percents {
+		header = append(header, kurl.PercentileName(percent)+"_ms")
+	}
+	for _, statusCode := range statusCodes {
+		header = append(header, fmt.Sprintf("http_%d", statusCode))
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, interval := range intervals {
+		// The last interval is cut short by the end of the run
+		rate := 0.0
+		if interval.Duration > 0 {
+			rate = float64(interval.CompletedCount) / interval.Duration.Seconds()
+		}
+		row := []string{
+			strconv.FormatFloat(interval.Start.Seconds(), 'f', -1, 64),
+			strconv.Itoa(interval.CompletedCount),
+			strconv.Itoa(interval.ErrorCount),
+			strconv.FormatFloat(rate, 'f', 1, 64),
+		}
+		for _, percent := range percentiles.percents {
+			latency := interval.Histogram.Percentile(percent / 100)
+			row = append(row, strconv.FormatFloat(float64(latency)/float64(time.Millisecond), 'f', 3, 64))
+		}
+		for _, statusCode := range statusCodes {
+			row = append(row, strconv.Itoa(interval.StatusCodesFrequency[statusCode]))
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}